@@ -0,0 +1,499 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+	"github.com/abramtrinh/koldb/ingest"
+	"github.com/abramtrinh/koldb/schedule"
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// missingError means the command did its job but some upstream data didn't
+// come (rejected lines, failed windows or chunks). main exits with exitMissing for these.
+type missingError struct {
+	err error
+}
+
+func (e *missingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *missingError) Unwrap() error {
+	return e.err
+}
+
+// Every kind fetch and load know, in the order they're listed in usage.
+var kinds = []data.Kind{data.KindItems, data.KindTrans, data.KindMarketPrices, data.KindMafiaPrices}
+
+func parseKind(value string) (data.Kind, bool) {
+	for _, kind := range kinds {
+		if string(kind) == value {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// The registered Source called name, or the one Source of the kind called name.
+func lookupSource(name string) (data.Source, error) {
+	if src, ok := data.Lookup(name); ok {
+		return src, nil
+	}
+	kind, ok := parseKind(name)
+	if !ok {
+		return nil, usagef("unknown kind or source %q", name)
+	}
+	src, ok := data.LookupKind(kind)
+	if !ok {
+		return nil, usagef("no single source for %s, name one of: %s", kind, strings.Join(sourceNames(), ", "))
+	}
+	return src, nil
+}
+
+func sourceNames() []string {
+	var names []string
+	for _, src := range data.Sources() {
+		names = append(names, src.Name())
+	}
+	return names
+}
+
+// koldb fetch items|trans|prices|mafia|<source name> [flags]
+// The flags depend on the source's kind, so a newly registered upstream gets them too.
+func runFetch(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return usagef("fetch needs a kind or source")
+	}
+	src, err := lookupSource(args[0])
+	if err != nil {
+		return err
+	}
+	kind := src.Kind()
+
+	fs := newFlagSet("fetch " + args[0])
+	out := fs.String("o", "", "file to write, relative to output.dir (default <kind>.json)")
+	var window data.Window
+	var from, to time.Time
+	item := ""
+	ids := ""
+	switch kind {
+	case data.KindTrans:
+		fs.Var(timeFlag{&from}, "from", "start of the range (default 24h before -to)")
+		fs.Var(timeFlag{&to}, "to", "end of the range (default now)")
+		fs.StringVar(&item, "item", "", "only this item ID")
+	case data.KindMarketPrices:
+		fs.StringVar(&ids, "items", "", "comma separated item IDs (default every item in the database)")
+	}
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	opts := data.Options{ItemID: item}
+	switch kind {
+	case data.KindTrans:
+		if item != "" {
+			if _, err := parseIDs(item); err != nil {
+				return usagef("%v", err)
+			}
+		}
+		if !to.IsZero() {
+			window.End = to.Unix()
+		}
+		if !from.IsZero() {
+			window.Start = from.Unix()
+		}
+		if window.End != 0 && window.Start >= window.End {
+			return usagef("-from must be before -to")
+		}
+	case data.KindMarketPrices:
+		itemIDs, err := parseIDs(ids)
+		if err != nil {
+			return usagef("%v", err)
+		}
+		if len(itemIDs) == 0 {
+			store, err := a.UpstreamStore(ctx)
+			if err != nil {
+				return err
+			}
+			if itemIDs, err = store.ItemIDs(ctx); err != nil {
+				return err
+			}
+			if len(itemIDs) == 0 {
+				return fmt.Errorf("no items in the database, run koldb load first or pass -items")
+			}
+		}
+		opts.ItemIDs = itemIDs
+	}
+
+	batch, err := data.Configure(src, opts).Fetch(ctx, window)
+	if err != nil {
+		return err
+	}
+
+	name := *out
+	if name == "" {
+		name = string(kind) + ".json"
+	}
+	name = a.cfg.Path(name)
+	if err := MarshalToJSONFile(batchRows(batch, kind), name); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d %s row(s) to %s\n", batch.Len(), kind, name)
+	return reportRejected(batch.Report)
+}
+
+// The Batch slice for kind, for marshalling.
+func batchRows(batch data.Batch, kind data.Kind) any {
+	switch kind {
+	case data.KindItems:
+		return batch.Items
+	case data.KindTrans:
+		return batch.Trans
+	case data.KindMarketPrices:
+		return batch.MarketPrices
+	default:
+		return batch.MafiaPrices
+	}
+}
+
+// Prints rejected lines. Any at all is a missingError.
+func reportRejected(report data.ParseReport) error {
+	for _, rejected := range report.Rejected {
+		fmt.Printf("rejected %v\n", rejected)
+	}
+	if len(report.Rejected) > 0 {
+		return &missingError{fmt.Errorf("%d line(s) rejected", len(report.Rejected))}
+	}
+	return nil
+}
+
+// koldb load [flags] <file>
+// The whole file is one Store.Ingest run, so a bad row rolls back all of it.
+func runLoad(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("load")
+	kindName := fs.String("kind", "", "items, trans, prices or mafia (default from the file name, ex. trans.json)")
+	var fetched time.Time
+	fs.Var(timeFlag{&fetched}, "fetched", "when prices were fetched (default the file's modification time)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usagef("load needs exactly one file")
+	}
+
+	file := fs.Arg(0)
+	if *kindName == "" {
+		*kindName = strings.TrimSuffix(filepath.Base(file), ".json")
+	}
+	kind, ok := parseKind(*kindName)
+	if !ok {
+		return usagef("can't tell what %s holds, pass -kind", file)
+	}
+
+	path := a.cfg.Path(file)
+	if filepath.IsAbs(file) {
+		path = file
+	}
+	byteSlice, err := OpenReadJSONFile(path)
+	if err != nil {
+		return err
+	}
+
+	run := database.Run{BatchSize: a.cfg.Database.BatchSize}
+	var rows int
+	switch kind {
+	case data.KindItems:
+		err = json.Unmarshal(byteSlice, &run.Items)
+		rows = len(run.Items)
+	case data.KindTrans:
+		err = json.Unmarshal(byteSlice, &run.Trans)
+		rows = len(run.Trans)
+	case data.KindMarketPrices:
+		err = json.Unmarshal(byteSlice, &run.MarketPrices)
+		rows = len(run.MarketPrices)
+		// Better than now for a file that sat around for a while.
+		if fetched.IsZero() {
+			if info, statErr := os.Stat(path); statErr == nil {
+				fetched = info.ModTime().UTC()
+			}
+		}
+		run.MarketPricesFetched = fetched
+	case data.KindMafiaPrices:
+		err = json.Unmarshal(byteSlice, &run.MafiaPrices)
+		rows = len(run.MafiaPrices)
+	}
+	if err != nil {
+		return fmt.Errorf("error unmarshalling %s as %s: %w", path, kind, err)
+	}
+
+	store, err := a.Store(ctx)
+	if err != nil {
+		return err
+	}
+	// Nothing is fetched, so a --dry-run takes the file's word for which items exist.
+	a.assumeItems(runItemIDs(run))
+	start := time.Now()
+	if err := store.Ingest(ctx, run); err != nil {
+		return err
+	}
+	fmt.Printf("stored %d %s row(s) from %s in %v\n", rows, kind, path, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Every itemID run's prices and transactions reference.
+func runItemIDs(run database.Run) []int {
+	var ids []int
+	for _, price := range run.MafiaPrices {
+		ids = append(ids, price.ItemID)
+	}
+	for _, price := range run.MarketPrices {
+		ids = append(ids, price.ItemID)
+	}
+	for _, trans := range run.Trans {
+		ids = append(ids, trans.ItemID)
+	}
+	return ids
+}
+
+// Flags shared by sync and backfill for how Backfill splits up the range.
+func planFlags(fs *flag.FlagSet, plan *data.BackfillPlan) {
+	fs.Int64Var(&plan.Window, "window", plan.Window, "seconds per request")
+	fs.IntVar(&plan.Concurrency, "concurrency", plan.Concurrency, "windows fetched at once")
+	fs.IntVar(&plan.FullThreshold, "full-threshold", plan.FullThreshold, "re-fetch a window as two halves when it has at least this many rows, -1 for off")
+}
+
+// Prints the failed and possibly truncated windows of a Backfill.
+func printWindows(windows []data.WindowResult) {
+	for _, window := range windows {
+		if window.Err != nil {
+			fmt.Printf("window %d-%d failed: %v\n", window.Window.Start, window.Window.End, window.Err)
+		}
+		if window.Truncated {
+			fmt.Printf("window %d-%d still had %d row(s) at the smallest window size, some may be missing\n",
+				window.Window.Start, window.Window.End, window.Rows)
+		}
+	}
+}
+
+// koldb sync [flags]
+func runSync(ctx context.Context, a *app, args []string) error {
+	opts := ingest.DefaultSyncOptions
+	opts.BatchSize = a.cfg.Database.BatchSize
+
+	fs := newFlagSet("sync")
+	fs.DurationVar(&opts.Overlap, "overlap", opts.Overlap, "re-read this much before the last sync")
+	fs.DurationVar(&opts.InitialLookback, "lookback", opts.InitialLookback, "how far back to start when the database has never synced")
+	fs.DurationVar(&opts.MaxSpan, "max-span", opts.MaxSpan, "store a longer gap in runs of this much, 0 stores it all at once")
+	planFlags(fs, &opts.Plan)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	store, err := a.UpstreamStore(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := ingest.Sync(ctx, store, opts)
+	printWindows(result.Windows)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("synced %s to %s: %d transaction(s) in %d window(s)\n",
+		result.Start.Format("2006-01-02 15:04:05"), result.End.Format("2006-01-02 15:04:05"), result.Rows, len(result.Windows))
+	if len(result.NewItems) > 0 {
+		fmt.Printf("added %d item(s) not in the database yet without a name, refresh the item list to name them: %v\n", len(result.NewItems), result.NewItems)
+	}
+	return nil
+}
+
+// koldb backfill -from <time> [-to <time>] [flags]
+// Each window is stored as its own Ingest run so a long backfill keeps what it got
+// if it's stopped. dbUpdate isn't touched, sync keeps going from where it was.
+func runBackfill(ctx context.Context, a *app, args []string) error {
+	plan := data.DefaultBackfillPlan
+	var from, to time.Time
+
+	fs := newFlagSet("backfill")
+	fs.Var(timeFlag{&from}, "from", "start of the range (required)")
+	fs.Var(timeFlag{&to}, "to", "end of the range (default now)")
+	fs.StringVar(&plan.ItemID, "item", "", "only this item ID")
+	planFlags(fs, &plan)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if from.IsZero() {
+		return usagef("backfill needs -from")
+	}
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	if !from.Before(to) {
+		return usagef("-from must be before -to")
+	}
+	if plan.ItemID != "" {
+		if _, err := parseIDs(plan.ItemID); err != nil {
+			return usagef("%v", err)
+		}
+	}
+
+	store, err := a.UpstreamStore(ctx)
+	if err != nil {
+		return err
+	}
+	ids, err := store.ItemIDs(ctx)
+	if err != nil {
+		return err
+	}
+	rows := 0
+	var newItems []int
+	var storeErr error
+	windows, err := data.Backfill(ctx, from.Unix(), to.Unix(), plan, func(window data.Window, trans []structs.MarketTrans) error {
+		if len(trans) == 0 {
+			return nil
+		}
+		// Like sync, items that aren't stored yet go in unnamed instead of failing the foreign key.
+		unknown := ingest.UnknownItems(trans, ids)
+		storeErr = store.Ingest(ctx, database.Run{Trans: trans, UnnamedItems: unknown, BatchSize: a.cfg.Database.BatchSize})
+		if storeErr != nil {
+			return storeErr
+		}
+		ids = append(ids, unknown...)
+		newItems = append(newItems, unknown...)
+		rows += len(trans)
+		return nil
+	})
+	printWindows(windows)
+	fmt.Printf("stored %d transaction(s) from %d window(s)\n", rows, len(windows))
+	if len(newItems) > 0 {
+		fmt.Printf("added %d item(s) not in the database yet without a name, refresh the item list to name them: %v\n", len(newItems), newItems)
+	}
+	if err != nil && storeErr == nil && ctx.Err() == nil {
+		// Only fetches failed. The rest is stored, rerun the range to fill the gaps.
+		return &missingError{err}
+	}
+	return err
+}
+
+// koldb refresh-prices [interval]
+// Pulls ColdFront prices for every known item once, or every interval if one is
+// given until Ctrl-C. The daemon's JobPrices is the same thing on the configured schedule.
+func runRefreshPrices(ctx context.Context, a *app, args []string) error {
+	if len(args) > 1 {
+		return usagef("unexpected argument %q", args[1])
+	}
+	store, err := a.UpstreamStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	printResult := func(result ingest.RefreshResult, err error) {
+		fmt.Printf("%s: stored %d of %d price(s), %d missing\n",
+			result.Fetched.Format("2006-01-02 15:04:05"), result.Stored, result.Items, len(result.Missing))
+		for _, rejected := range result.Report.Rejected {
+			fmt.Printf("rejected %v\n", rejected)
+		}
+		if err != nil {
+			fmt.Printf("error %v\n", err)
+		}
+	}
+
+	if len(args) == 0 {
+		result, err := ingest.RefreshMarketPrices(ctx, store, nil)
+		printResult(result, nil)
+		if err != nil && result.Stored > 0 {
+			return &missingError{err}
+		}
+		return err
+	}
+
+	interval, err := time.ParseDuration(args[0])
+	if err != nil || interval <= 0 {
+		return usagef("bad interval %q", args[0])
+	}
+	// Same scheduler as the daemon's JobPrices, so a slow refresh skips the
+	// runs it overlaps and a panic is logged instead of ending the command.
+	scheduler := &schedule.Scheduler{
+		Jobs: []schedule.Job{{
+			Name:     ingest.JobPrices,
+			Schedule: schedule.Every(interval),
+			Run: func(ctx context.Context) error {
+				result, err := ingest.RefreshMarketPrices(ctx, store, nil)
+				printResult(result, nil)
+				return err
+			},
+		}},
+		Logf: log.Printf,
+	}
+	err = scheduler.Run(ctx, ctx.Done())
+	// Ctrl-C is how this one normally ends.
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// koldb migrate up|down [n]|status
+func runMigrate(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return usagef("migrate needs up, down or status")
+	}
+	store, err := a.Store(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := store.MigrateUp(ctx)
+		fmt.Printf("applied %d migration(s)\n", count)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return usagef("bad step count %q", args[1])
+			}
+			steps = n
+		}
+		count, err := store.MigrateDown(ctx, steps)
+		fmt.Printf("reverted %d migration(s)\n", count)
+		return err
+	case "status":
+		statuses, err := store.MigrationStatuses(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.Applied {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05") + " UTC"
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return usagef("unknown migrate command %q", args[0])
+	}
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+	"github.com/abramtrinh/koldb/ingest"
+	"github.com/abramtrinh/koldb/schedule"
+	"github.com/joho/godotenv"
+)
+
+// Config is everything koldb can be told. Load fills it from, lowest to highest
+// precedence: Default, a YAML file, KOLDB_* env vars, then command line flags.
+type Config struct {
+	Database Database
+	Upstream Upstream
+	Output   Output
+	Schedule Schedule
+}
+
+type Database struct {
+	// mysql, postgres or sqlite.
+	Driver string
+	DSN    string
+	// Old style env file (DBUSER, DBPASS...) still read if it exists. Mostly for the DSN.
+	EnvFile      string
+	MaxOpenConns int
+	Workers      int
+	BatchSize    int
+}
+
+type Upstream struct {
+	ItemsURL     string
+	ColdFrontURL string
+	MafiaURL     string
+	Timeout      time.Duration
+	// Requests per second per host. 0 turns limiting off.
+	RateLimit   float64
+	Burst       int
+	MaxAttempts int
+}
+
+type Output struct {
+	// Where JSON dumps are written and read from.
+	Dir string
+}
+
+// Schedule is when the daemon runs each ingest job. nil turns the job off.
+type Schedule struct {
+	Trans  schedule.Schedule
+	Mafia  schedule.Schedule
+	Items  schedule.Schedule
+	Prices schedule.Schedule
+	// Cron expressions are read in this zone. Everything stored stays UTC.
+	Timezone *time.Location
+}
+
+// For is the schedule of the ingest job named job (ex. ingest.JobMafia), in Timezone.
+func (s Schedule) For(job string) schedule.Schedule {
+	var when schedule.Schedule
+	switch job {
+	case ingest.JobTrans:
+		when = s.Trans
+	case ingest.JobMafia:
+		when = s.Mafia
+	case ingest.JobItems:
+		when = s.Items
+	case ingest.JobPrices:
+		when = s.Prices
+	}
+	return schedule.In(when, s.Timezone)
+}
+
+// Default is what koldb did before there was a config.
+func Default() Config {
+	return Config{
+		Database: Database{
+			Driver:  database.DriverMySQL,
+			EnvFile: "db.env",
+		},
+		Upstream: Upstream{
+			ItemsURL:     data.DefaultEndpoints.Items,
+			ColdFrontURL: data.DefaultEndpoints.ColdFront,
+			MafiaURL:     data.DefaultEndpoints.Mafia,
+			Timeout:      data.DefaultTimeout,
+			RateLimit:    data.DefaultRateLimit.PerSecond,
+			Burst:        data.DefaultRateLimit.Burst,
+			MaxAttempts:  data.DefaultRetryPolicy.MaxAttempts,
+		},
+		Output: Output{Dir: "./"},
+		// Prices is off since a full refresh takes a while at the default rate limit.
+		Schedule: Schedule{
+			Trans:    schedule.Every(10 * time.Minute),
+			Mafia:    schedule.Every(time.Hour),
+			Items:    schedule.Every(24 * time.Hour),
+			Timezone: time.UTC,
+		},
+	}
+}
+
+// KeyError is a bad config value. Key is the YAML key (ex. "upstream.rate_limit")
+// and Source where the value came from.
+type KeyError struct {
+	Key    string
+	Source string
+	Err    error
+}
+
+func (e *KeyError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("error config %s: %v", e.Key, e.Err)
+	}
+	return fmt.Sprintf("error config %s (%s): %v", e.Key, e.Source, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// Flags holds what RegisterFlags added until Load applies it.
+type Flags struct {
+	path   string
+	values map[string]string
+}
+
+// RegisterFlags adds -config plus one flag per key to fs, named after the key
+// with dashes (upstream.rate_limit is -upstream-rate-limit). Pass the result to
+// Load once fs is parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{values: map[string]string{}}
+	fs.StringVar(&flags.path, "config", "", "YAML config file (default $KOLDB_CONFIG, else koldb.yaml if it exists)")
+	for _, s := range settings {
+		s := s
+		fs.Func(flagName(s.key), s.usage, func(value string) error {
+			flags.values[s.key] = value
+			return nil
+		})
+	}
+	return flags
+}
+
+// Load builds the Config. flags can be nil if there's no command line.
+func Load(flags *Flags) (Config, error) {
+	if flags == nil {
+		flags = &Flags{values: map[string]string{}}
+	}
+	cfg := Default()
+	sources := map[string]string{}
+
+	path, required := flags.path, true
+	if path == "" {
+		path = os.Getenv("KOLDB_CONFIG")
+	}
+	if path == "" {
+		path, required = "koldb.yaml", false
+	}
+	if err := loadFile(&cfg, sources, path, required); err != nil {
+		return Config{}, err
+	}
+
+	// KOLDB_DATABASE_ENV_FILE has to be known before the env file can be read.
+	if err := applyEnv(&cfg, sources, "database.env_file"); err != nil {
+		return Config{}, err
+	}
+	if value, ok := flags.values["database.env_file"]; ok {
+		if err := apply(&cfg, sources, "database.env_file", value, "flag -"+flagName("database.env_file")); err != nil {
+			return Config{}, err
+		}
+	}
+	if cfg.Database.EnvFile != "" {
+		// Doesn't override anything already in the environment.
+		err := godotenv.Load(cfg.Database.EnvFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return Config{}, &KeyError{Key: "database.env_file", Source: sources["database.env_file"], Err: err}
+		}
+	}
+
+	if err := applyEnv(&cfg, sources, ""); err != nil {
+		return Config{}, err
+	}
+	for _, s := range settings {
+		if value, ok := flags.values[s.key]; ok {
+			if err := apply(&cfg, sources, s.key, value, "flag -"+flagName(s.key)); err != nil {
+				return Config{}, err
+			}
+		}
+	}
+
+	// Nothing set the DSN, build it from the old db.env variables.
+	if cfg.Database.DSN == "" {
+		cfg.Database.DSN = database.DSNFromEnv(cfg.Database.Driver)
+	}
+
+	if err := cfg.validate(sources); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Path is name inside Output.Dir.
+func (c Config) Path(name string) string {
+	return filepath.Join(c.Output.Dir, name)
+}
+
+// Store is the database.Config for Open.
+func (c Config) Store() database.Config {
+	return database.Config{
+		Driver:       c.Database.Driver,
+		DSN:          c.Database.DSN,
+		MaxOpenConns: c.Database.MaxOpenConns,
+		Bulk: database.BulkOptions{
+			Workers:   c.Database.Workers,
+			BatchSize: c.Database.BatchSize,
+		},
+	}
+}
+
+// Client is a data.Client with the upstream URLs, timeout, retries and rate limit.
+func (c Config) Client() *data.Client {
+	client := data.NewClient(&http.Client{Timeout: c.Upstream.Timeout})
+	client.Retry.MaxAttempts = c.Upstream.MaxAttempts
+	client.Limiter = data.NewHostLimiter(data.RateLimit{PerSecond: c.Upstream.RateLimit, Burst: c.Upstream.Burst})
+	client.Endpoints = data.Endpoints{
+		Items:     c.Upstream.ItemsURL,
+		ColdFront: c.Upstream.ColdFrontURL,
+		Mafia:     c.Upstream.MafiaURL,
+	}
+	return client
+}
+
+func (c Config) validate(sources map[string]string) error {
+	bad := func(key string, format string, args ...any) error {
+		return &KeyError{Key: key, Source: sources[key], Err: fmt.Errorf(format, args...)}
+	}
+
+	switch c.Database.Driver {
+	case database.DriverMySQL, database.DriverPostgres, database.DriverSQLite:
+	default:
+		return bad("database.driver", "want %s, %s or %s, got %q", database.DriverMySQL, database.DriverPostgres, database.DriverSQLite, c.Database.Driver)
+	}
+	if c.Database.DSN == "" {
+		return bad("database.dsn", "required")
+	}
+	if c.Database.MaxOpenConns < 0 {
+		return bad("database.max_open_conns", "must be >= 0, got %d", c.Database.MaxOpenConns)
+	}
+	if c.Database.Workers < 0 {
+		return bad("database.workers", "must be >= 0, got %d", c.Database.Workers)
+	}
+	if c.Database.BatchSize < 0 {
+		return bad("database.batch_size", "must be >= 0, got %d", c.Database.BatchSize)
+	}
+
+	urls := []struct{ key, value string }{
+		{"upstream.items_url", c.Upstream.ItemsURL},
+		{"upstream.coldfront_url", c.Upstream.ColdFrontURL},
+		{"upstream.mafia_url", c.Upstream.MafiaURL},
+	}
+	for _, u := range urls {
+		parsed, err := url.Parse(u.value)
+		if err != nil {
+			return bad(u.key, "%v", err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return bad(u.key, "want an http(s) URL, got %q", u.value)
+		}
+	}
+	if c.Upstream.Timeout <= 0 {
+		return bad("upstream.timeout", "must be > 0, got %v", c.Upstream.Timeout)
+	}
+	if c.Upstream.RateLimit < 0 {
+		return bad("upstream.rate_limit", "must be >= 0, got %v", c.Upstream.RateLimit)
+	}
+	if c.Upstream.RateLimit > 0 && c.Upstream.Burst < 1 {
+		return bad("upstream.burst", "must be >= 1 when rate_limit is on, got %d", c.Upstream.Burst)
+	}
+	if c.Upstream.MaxAttempts < 1 {
+		return bad("upstream.max_attempts", "must be >= 1, got %d", c.Upstream.MaxAttempts)
+	}
+
+	if c.Output.Dir == "" {
+		return bad("output.dir", "required")
+	}
+	return nil
+}
+
+// "upstream.rate_limit" is KOLDB_UPSTREAM_RATE_LIMIT.
+func envName(key string) string {
+	return "KOLDB_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// "upstream.rate_limit" is -upstream-rate-limit.
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(key)
+}
+
+// Applies env vars for every key, or just only if it isn't "".
+func applyEnv(cfg *Config, sources map[string]string, only string) error {
+	for _, s := range settings {
+		if only != "" && s.key != only {
+			continue
+		}
+		name := envName(s.key)
+		value, ok := os.LookupEnv(name)
+		if !ok && s.legacyEnv != "" {
+			name = s.legacyEnv
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok {
+			continue
+		}
+		if err := apply(cfg, sources, s.key, value, "env "+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apply(cfg *Config, sources map[string]string, key string, value string, source string) error {
+	s, ok := lookup(key)
+	if !ok {
+		return &KeyError{Key: key, Source: source, Err: errors.New("unknown key")}
+	}
+	if err := s.set(cfg, strings.TrimSpace(value)); err != nil {
+		return &KeyError{Key: key, Source: source, Err: err}
+	}
+	sources[key] = source
+	return nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes content to a koldb.yaml in a temp dir and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "koldb.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Load with args parsed as the command line.
+func load(t *testing.T, args ...string) (Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("koldb", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%v) error = %v", args, err)
+	}
+	return Load(flags)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+database:
+  driver: sqlite
+  dsn: file.db
+  env_file: ""
+upstream:
+  rate_limit: 1
+  timeout: 10s
+  max_attempts: 2
+`)
+	t.Setenv("KOLDB_UPSTREAM_RATE_LIMIT", "2")
+	t.Setenv("KOLDB_UPSTREAM_TIMEOUT", "20s")
+
+	cfg, err := load(t, "-config", path, "-upstream-rate-limit", "3")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	// Flag over env over file over Default.
+	if cfg.Upstream.RateLimit != 3 {
+		t.Errorf("upstream.rate_limit = %v, want the flag's 3", cfg.Upstream.RateLimit)
+	}
+	if cfg.Upstream.Timeout != 20*time.Second {
+		t.Errorf("upstream.timeout = %v, want the env's 20s", cfg.Upstream.Timeout)
+	}
+	if cfg.Upstream.MaxAttempts != 2 || cfg.Database.Driver != "sqlite" || cfg.Database.DSN != "file.db" {
+		t.Errorf("Load() = %+v, want the file's max_attempts, driver and dsn", cfg)
+	}
+	if cfg.Upstream.ColdFrontURL != Default().Upstream.ColdFrontURL || cfg.Output.Dir != Default().Output.Dir {
+		t.Errorf("Load() = %+v, want Default for keys nothing set", cfg)
+	}
+}
+
+func TestLoadNamesBadKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		env    map[string]string
+		args   []string
+		key    string
+		source string
+	}{
+		{
+			name:   "file value",
+			file:   "database:\n  driver: sqlite\n  dsn: file.db\nupstream:\n  timeout: soon\n",
+			key:    "upstream.timeout",
+			source: "line 5",
+		},
+		{
+			name:   "unknown file key",
+			file:   "database:\n  driver: sqlite\n  dsn: file.db\n  colour: blue\n",
+			key:    "database.colour",
+			source: "line 4",
+		},
+		{
+			name:   "env value",
+			file:   "database:\n  driver: sqlite\n  dsn: file.db\n",
+			env:    map[string]string{"KOLDB_UPSTREAM_BURST": "lots"},
+			key:    "upstream.burst",
+			source: "env KOLDB_UPSTREAM_BURST",
+		},
+		{
+			name:   "flag out of range",
+			file:   "database:\n  driver: sqlite\n  dsn: file.db\n",
+			args:   []string{"-upstream-rate-limit", "-1"},
+			key:    "upstream.rate_limit",
+			source: "flag -upstream-rate-limit",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			t.Setenv("KOLDB_DATABASE_ENV_FILE", "")
+			args := append([]string{"-config", writeConfig(t, tt.file)}, tt.args...)
+
+			_, err := load(t, args...)
+			var keyErr *KeyError
+			if !errors.As(err, &keyErr) {
+				t.Fatalf("Load() error = %v, want a *KeyError", err)
+			}
+			if keyErr.Key != tt.key || !strings.Contains(keyErr.Source, tt.source) {
+				t.Errorf("KeyError key %q from %q, want %q from %q", keyErr.Key, keyErr.Source, tt.key, tt.source)
+			}
+			if !strings.Contains(err.Error(), tt.key) {
+				t.Errorf("Load() error = %q, want it to name %s", err, tt.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abramtrinh/koldb/schedule"
+	"gopkg.in/yaml.v3"
+)
+
+// setting is one config key. The same table drives the YAML file, env vars
+// and flags so the three can't drift apart.
+type setting struct {
+	// YAML path, ex. "upstream.rate_limit".
+	key   string
+	usage string
+	// Checked after KOLDB_* so db.env style files keep working.
+	legacyEnv string
+	set       func(cfg *Config, value string) error
+}
+
+var settings = []setting{
+	{key: "database.driver", usage: "database backend: mysql, postgres or sqlite", legacyEnv: "DRIVER",
+		set: stringValue(func(c *Config) *string { return &c.Database.Driver })},
+	{key: "database.dsn", usage: "database DSN (sqlite: file path). Built from DBUSER, DBPASS... if unset",
+		set: stringValue(func(c *Config) *string { return &c.Database.DSN })},
+	{key: "database.env_file", usage: "old style db.env file to read env vars from, \"\" to skip",
+		set: stringValue(func(c *Config) *string { return &c.Database.EnvFile })},
+	{key: "database.max_open_conns", usage: "max open database connections, 0 for the driver default",
+		set: intValue(func(c *Config) *int { return &c.Database.MaxOpenConns })},
+	{key: "database.workers", usage: "bulk insert workers, 0 for one per connection",
+		set: intValue(func(c *Config) *int { return &c.Database.Workers })},
+	{key: "database.batch_size", usage: "rows per INSERT, 0 for the default",
+		set: intValue(func(c *Config) *int { return &c.Database.BatchSize })},
+	{key: "upstream.items_url", usage: "item index URL",
+		set: stringValue(func(c *Config) *string { return &c.Upstream.ItemsURL })},
+	{key: "upstream.coldfront_url", usage: "ColdFront newmarket base URL",
+		set: stringValue(func(c *Config) *string { return &c.Upstream.ColdFrontURL })},
+	{key: "upstream.mafia_url", usage: "kolmafia updateprices.php URL",
+		set: stringValue(func(c *Config) *string { return &c.Upstream.MafiaURL })},
+	{key: "upstream.timeout", usage: "HTTP timeout per request, ex. 30s",
+		set: durationValue(func(c *Config) *time.Duration { return &c.Upstream.Timeout })},
+	{key: "upstream.rate_limit", usage: "requests per second per upstream host, 0 for no limit",
+		set: floatValue(func(c *Config) *float64 { return &c.Upstream.RateLimit })},
+	{key: "upstream.burst", usage: "requests allowed at once before rate_limit kicks in",
+		set: intValue(func(c *Config) *int { return &c.Upstream.Burst })},
+	{key: "upstream.max_attempts", usage: "tries per request including the first",
+		set: intValue(func(c *Config) *int { return &c.Upstream.MaxAttempts })},
+	{key: "output.dir", usage: "directory for JSON dumps",
+		set: stringValue(func(c *Config) *string { return &c.Output.Dir })},
+	{key: "schedule.trans", usage: "when the daemon syncs ColdFront transactions: a duration like 10m, a cron expression like \"35 3 * * *\", or 0 for never",
+		set: scheduleValue(func(c *Config) *schedule.Schedule { return &c.Schedule.Trans })},
+	{key: "schedule.mafia", usage: "when the daemon stores kolmafia prices, same format as schedule.trans",
+		set: scheduleValue(func(c *Config) *schedule.Schedule { return &c.Schedule.Mafia })},
+	{key: "schedule.items", usage: "when the daemon stores the item list, same format as schedule.trans",
+		set: scheduleValue(func(c *Config) *schedule.Schedule { return &c.Schedule.Items })},
+	{key: "schedule.prices", usage: "when the daemon refreshes ColdFront latest prices, same format as schedule.trans",
+		set: scheduleValue(func(c *Config) *schedule.Schedule { return &c.Schedule.Prices })},
+	{key: "schedule.timezone", usage: "time zone cron expressions are read in, ex. America/Phoenix",
+		set: locationValue(func(c *Config) **time.Location { return &c.Schedule.Timezone })},
+}
+
+func lookup(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+func stringValue(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func intValue(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("want a whole number, got %q", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatValue(field func(*Config) *float64) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("want a number, got %q", value)
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func durationValue(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("want a duration like 30s or 5m, got %q", value)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func scheduleValue(field func(*Config) *schedule.Schedule) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		s, err := schedule.Parse(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = s
+		return nil
+	}
+}
+
+func locationValue(field func(*Config) **time.Location) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		loc, err := time.LoadLocation(value)
+		if err != nil {
+			return fmt.Errorf("want a time zone like UTC or America/Phoenix, got %q", value)
+		}
+		*field(c) = loc
+		return nil
+	}
+}
+
+// Reads the YAML file at path into cfg. A missing file is only an error if required.
+// The file is walked as plain nodes instead of decoded into Config so errors can name the key.
+func loadFile(cfg *Config, sources map[string]string, path string, required bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		// Empty file.
+		return nil
+	}
+	return walk(cfg, sources, path, "", doc.Content[0])
+}
+
+// Flattens mapping nodes into dotted keys and applies each scalar.
+func walk(cfg *Config, sources map[string]string, path string, prefix string, node *yaml.Node) error {
+	source := fmt.Sprintf("file %s line %d", path, node.Line)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			if err := walk(cfg, sources, path, key, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case yaml.ScalarNode:
+		if prefix == "" {
+			return fmt.Errorf("error config %s: want a mapping of keys at the top", path)
+		}
+		// A section without keys (ex. "database:") is null, not a value.
+		if node.Tag == "!!null" && !strings.Contains(prefix, ".") {
+			return nil
+		}
+		return apply(cfg, sources, prefix, node.Value, source)
+	default:
+		return &KeyError{Key: prefix, Source: source, Err: errors.New("want a single value")}
+	}
+}
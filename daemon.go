@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/abramtrinh/koldb/ingest"
+	"github.com/abramtrinh/koldb/schedule"
+)
+
+// koldb daemon [-jobs name,name]
+// Runs each ingest job on its schedule.* config until SIGTERM or Ctrl-C. The first
+// signal stops new runs and waits for the ones in flight, a second aborts them.
+// Every run is recorded in dbUpdate, which is also where a restart picks the schedule up from.
+func runDaemon(ctx context.Context, a *app, args []string) error {
+	fs := newFlagSet("daemon")
+	only := fs.String("jobs", "", "comma separated jobs to run (default every job with a schedule): "+strings.Join(ingest.Jobs(), ", "))
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(*only, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+	for name := range wanted {
+		if !isJob(name) {
+			return usagef("unknown job %q", name)
+		}
+	}
+
+	store, err := a.UpstreamStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := ingest.DefaultSyncOptions
+	opts.BatchSize = a.cfg.Database.BatchSize
+	var jobs []schedule.Job
+	for _, name := range ingest.Jobs() {
+		name := name
+		if len(wanted) > 0 && !wanted[name] {
+			continue
+		}
+		when := a.cfg.Schedule.For(name)
+		if when == nil {
+			if wanted[name] {
+				return usagef("job %s has no schedule, set schedule.* in the config", name)
+			}
+			continue
+		}
+		jobs = append(jobs, schedule.Job{
+			Name:     name,
+			Schedule: when,
+			Run: func(ctx context.Context) error {
+				result, err := ingest.RunJob(ctx, store, name, opts)
+				for _, rejected := range result.Report.Rejected {
+					log.Printf("%s: rejected %v", name, rejected)
+				}
+				if len(result.NewItems) > 0 {
+					log.Printf("%s: added %d item(s) not in the item list yet without a name: %v", name, len(result.NewItems), result.NewItems)
+				}
+				if err == nil {
+					log.Printf("%s: stored %d row(s)", name, result.Rows)
+				}
+				return err
+			},
+		})
+	}
+	if len(jobs) == 0 {
+		return usagef("no jobs to run, every schedule.* is off")
+	}
+
+	// ctx ends on the first signal, which stops the scheduling. Runs get their own
+	// context so they can finish, and only a second signal cancels it.
+	runCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for count := 0; ; count++ {
+			select {
+			case <-signals:
+			case <-done:
+				return
+			}
+			if count == 0 {
+				log.Printf("stopping, waiting for running jobs. Signal again to abort them")
+				continue
+			}
+			log.Printf("aborting running jobs")
+			abort()
+			return
+		}
+	}()
+
+	scheduler := &schedule.Scheduler{
+		Jobs: jobs,
+		LastRun: func(ctx context.Context, job string) (time.Time, error) {
+			run, err := store.LastRun(ctx, job)
+			if errors.Is(err, sql.ErrNoRows) {
+				return time.Time{}, nil
+			}
+			return run.Finished, err
+		},
+		Logf: log.Printf,
+	}
+	log.Printf("daemon running %d job(s)", len(jobs))
+	if err := scheduler.Run(runCtx, ctx.Done()); err != nil {
+		return fmt.Errorf("aborted with jobs still running: %w", err)
+	}
+	log.Printf("daemon stopped")
+	return nil
+}
+
+// koldb schedule list [-n count]
+// Shows each job's schedule, last run and next fire times the way the daemon works them out.
+func runSchedule(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return usagef("schedule needs list")
+	}
+	fs := newFlagSet("schedule list")
+	count := fs.Int("n", 3, "fire times to show per job")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usagef("unexpected argument %q", fs.Arg(0))
+	}
+	if *count < 1 {
+		return usagef("-n must be >= 1, got %d", *count)
+	}
+
+	// Last runs only move interval jobs, so the list is still worth showing without a database.
+	store, err := a.Store(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "last runs unknown, %v\n", err)
+	}
+
+	const timeFormat = "2006-01-02 15:04:05 MST"
+	loc := a.cfg.Schedule.Timezone
+	now := time.Now()
+	fmt.Printf("times in %s\n", loc)
+	for _, name := range ingest.Jobs() {
+		when := a.cfg.Schedule.For(name)
+		if when == nil {
+			fmt.Printf("\n%s: off\n", name)
+			continue
+		}
+		fmt.Printf("\n%s: %v\n", name, when)
+
+		var last time.Time
+		if store != nil {
+			run, err := store.LastRun(ctx, name)
+			switch {
+			case err == nil:
+				last = run.Finished
+				fmt.Printf("  last run  %s, %d row(s)\n", last.In(loc).Format(timeFormat), run.Rows)
+			case errors.Is(err, sql.ErrNoRows):
+				fmt.Printf("  last run  never\n")
+			default:
+				return err
+			}
+		}
+
+		next := schedule.First(when, last, now)
+		for i := 0; i < *count; i++ {
+			if i == 0 && !next.After(now) {
+				fmt.Printf("  next      now (overdue)\n")
+			} else {
+				fmt.Printf("  next      %s\n", next.In(loc).Format(timeFormat))
+			}
+			next = when.Next(next)
+		}
+	}
+	return nil
+}
+
+func isJob(name string) bool {
+	for _, job := range ingest.Jobs() {
+		if job == name {
+			return true
+		}
+	}
+	return false
+}
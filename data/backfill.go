@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// BackfillPlan says how Backfill splits up a big time range.
+type BackfillPlan struct {
+	// Seconds per window. Default EpochHour.
+	Window int64
+	// Smallest size a full window gets split down to. Default 60.
+	MinWindow int64
+	// Windows fetched at once. Default 1. The Client's rate limiter still applies on top.
+	Concurrency int
+	// A window with at least this many rows is assumed truncated and is fetched
+	// again as two halves. Default DefaultFullThreshold, negative turns it off.
+	FullThreshold int
+	// Passed to MarketURLTransID. Empty means all items.
+	ItemID string
+}
+
+// ColdFront's export doesn't say how many rows it caps a response at, so this
+// is kept well under what a busy hour of the whole market sees. Splitting a window
+// that wasn't really truncated only costs a couple of extra requests.
+const DefaultFullThreshold = 1000
+
+// DefaultBackfillPlan is hour windows fetched one at a time.
+var DefaultBackfillPlan = BackfillPlan{
+	Window:        EpochHour,
+	MinWindow:     60,
+	Concurrency:   1,
+	FullThreshold: DefaultFullThreshold,
+}
+
+// WindowResult is what happened to one window of a Backfill.
+type WindowResult struct {
+	Window Window
+	Rows   int
+	// Rows hit FullThreshold so the window was thrown out and re-fetched as two
+	// halves. The halves have their own results.
+	Split bool
+	// Rows hit FullThreshold but the window was already MinWindow, so it was
+	// kept as is and may be missing rows.
+	Truncated bool
+	Duration  time.Duration
+	Err       error
+}
+
+// Backfill fetches ColdFront transactions for [start, end) window by window.
+// fn gets each window's rows once the window is known to be complete. Calls to fn
+// never overlap, even with Concurrency > 1. A failed window doesn't stop the
+// others, but an error from fn or a cancelled ctx stops everything.
+// A trade right on a boundary may show up in two windows.
+func Backfill(ctx context.Context, start int64, end int64, plan BackfillPlan, fn func(Window, []structs.MarketTrans) error) ([]WindowResult, error) {
+	return DefaultClient.Backfill(ctx, start, end, plan, fn)
+}
+
+// Backfill using c.
+func (c *Client) Backfill(ctx context.Context, start int64, end int64, plan BackfillPlan, fn func(Window, []structs.MarketTrans) error) ([]WindowResult, error) {
+	if end <= start {
+		return nil, fmt.Errorf("error backfill end %d is not after start %d", end, start)
+	}
+	if plan.Window <= 0 {
+		plan.Window = DefaultBackfillPlan.Window
+	}
+	if plan.MinWindow <= 0 {
+		plan.MinWindow = DefaultBackfillPlan.MinWindow
+	}
+	if plan.Concurrency < 1 {
+		plan.Concurrency = DefaultBackfillPlan.Concurrency
+	}
+	if plan.FullThreshold == 0 {
+		plan.FullThreshold = DefaultBackfillPlan.FullThreshold
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b := &backfill{client: c, plan: plan, fn: fn, cancel: cancel}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, plan.Concurrency)
+	for windowStart := start; windowStart < end; windowStart += plan.Window {
+		window := Window{Start: windowStart, End: windowStart + plan.Window}
+		if window.End > end {
+			window.End = end
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			b.fetch(ctx, window)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(b.results, func(i, j int) bool {
+		if b.results[i].Window.Start != b.results[j].Window.Start {
+			return b.results[i].Window.Start < b.results[j].Window.Start
+		}
+		// Split parent before its first half.
+		return b.results[i].Window.End > b.results[j].Window.End
+	})
+
+	if b.fnErr != nil {
+		return b.results, b.fnErr
+	}
+	if err := ctx.Err(); err != nil {
+		return b.results, fmt.Errorf("error backfill cancelled: %w", err)
+	}
+	if b.failed > 0 {
+		return b.results, fmt.Errorf("error backfill %d window(s) failed", b.failed)
+	}
+	return b.results, nil
+}
+
+// State shared by one Backfill's workers.
+type backfill struct {
+	client *Client
+	plan   BackfillPlan
+	fn     func(Window, []structs.MarketTrans) error
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	results []WindowResult
+	failed  int
+	fnErr   error
+}
+
+// Fetches one window, splitting it in half (in this goroutine) if it looks truncated.
+func (b *backfill) fetch(ctx context.Context, window Window) {
+	began := time.Now()
+	URL := b.client.Endpoints.MarketURLTransID(window.Start, window.End, b.plan.ItemID)
+	// Held until we know the window is complete so a truncated one is never handed to fn.
+	trans, err := b.client.MarketParseTrans(ctx, URL)
+	result := WindowResult{Window: window, Rows: len(trans), Duration: time.Since(began), Err: err}
+
+	full := err == nil && b.plan.FullThreshold > 0 && len(trans) >= b.plan.FullThreshold
+	// Only split if both halves are still at least MinWindow.
+	if full && window.End-window.Start >= 2*b.plan.MinWindow {
+		result.Split = true
+		b.record(result)
+
+		mid := window.Start + (window.End-window.Start)/2
+		b.fetch(ctx, Window{Start: window.Start, End: mid})
+		b.fetch(ctx, Window{Start: mid, End: window.End})
+		return
+	}
+
+	result.Truncated = full
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil && b.fnErr == nil {
+		if fnErr := b.fn(window, trans); fnErr != nil {
+			result.Err = fnErr
+			b.fnErr = fmt.Errorf("error backfill handling window %d-%d: %w", window.Start, window.End, fnErr)
+			b.cancel()
+		}
+	}
+	if result.Err != nil {
+		b.failed++
+	}
+	b.results = append(b.results, result)
+}
+
+func (b *backfill) record(result WindowResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.results = append(b.results, result)
+}
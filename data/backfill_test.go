@@ -0,0 +1,122 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// Serves one trade per second of the requested window, capped at limit rows like
+// a truncating upstream would.
+func transServer(t *testing.T, limit int) (*Client, *[]Window) {
+	var mu sync.Mutex
+	var requested []Window
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+		mu.Lock()
+		requested = append(requested, Window{Start: start, End: end})
+		mu.Unlock()
+
+		var body strings.Builder
+		body.WriteString("<marketplace>")
+		for when := start; when < end && when-start < int64(limit); when++ {
+			fmt.Fprintf(&body, `<trans id="%d"><itemid>1</itemid><vol>1</vol><cost>1</cost><when>%d</when></trans>`, when, when)
+		}
+		body.WriteString("</marketplace>")
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(body.String()))
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{HTTP: srv.Client(), Endpoints: Endpoints{ColdFront: srv.URL}}, &requested
+}
+
+func TestBackfillWindows(t *testing.T) {
+	client, requested := transServer(t, 1000)
+	var got []Window
+	results, err := client.Backfill(context.Background(), 0, 250, BackfillPlan{Window: 100}, func(window Window, trans []structs.MarketTrans) error {
+		got = append(got, window)
+		if len(trans) != int(window.End-window.Start) {
+			t.Errorf("window %v got %d rows", window, len(trans))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	want := []Window{{0, 100}, {100, 200}, {200, 250}}
+	if fmt.Sprint(got) != fmt.Sprint(want) || len(*requested) != 3 || len(results) != 3 {
+		t.Errorf("Backfill() windows = %v, requested %v, want %v", got, *requested, want)
+	}
+}
+
+func TestBackfillSplitsFullWindows(t *testing.T) {
+	// The upstream caps at 40 rows so a 100 second window is truncated.
+	client, _ := transServer(t, 40)
+	rows := 0
+	results, err := client.Backfill(context.Background(), 0, 100, BackfillPlan{Window: 100, MinWindow: 10, FullThreshold: 40}, func(window Window, trans []structs.MarketTrans) error {
+		rows += len(trans)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	if rows != 100 {
+		t.Errorf("Backfill() stored %d rows, want all 100", rows)
+	}
+	splits := 0
+	for _, result := range results {
+		if result.Split {
+			splits++
+		}
+		if result.Truncated {
+			t.Errorf("window %v marked truncated", result.Window)
+		}
+	}
+	// 100 -> 50 + 50 -> 25 x4.
+	if splits != 3 {
+		t.Errorf("Backfill() split %d windows, want 3", splits)
+	}
+}
+
+func TestBackfillFlagsTruncatedAtMinWindow(t *testing.T) {
+	client, _ := transServer(t, 5)
+	results, err := client.Backfill(context.Background(), 0, 20, BackfillPlan{Window: 20, MinWindow: 10, FullThreshold: 5}, func(Window, []structs.MarketTrans) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	truncated := 0
+	for _, result := range results {
+		if result.Truncated {
+			truncated++
+		}
+	}
+	if truncated != 2 {
+		t.Errorf("Backfill() results = %+v, want both 10 second halves truncated", results)
+	}
+}
+
+func TestBackfillNeverFetchesUnderMinWindow(t *testing.T) {
+	// Every window is full, so it keeps splitting until it can't.
+	client, requested := transServer(t, 1)
+	_, err := client.Backfill(context.Background(), 0, 3600, BackfillPlan{Window: 3600, MinWindow: 60, FullThreshold: 1}, func(Window, []structs.MarketTrans) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Backfill() error = %v", err)
+	}
+	for _, window := range *requested {
+		if window.End-window.Start < 60 {
+			t.Errorf("Backfill() fetched %v, narrower than MinWindow", window)
+		}
+	}
+}
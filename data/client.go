@@ -0,0 +1,108 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// DefaultTimeout is the per request timeout when NewClient is given a nil *http.Client.
+const DefaultTimeout = 30 * time.Second
+
+// Client does the actual HTTP for the parsers. Swap HTTP out to change the
+// transport/timeouts or to point at an httptest server.
+type Client struct {
+	HTTP  *http.Client
+	Retry RetryPolicy
+	// Checked before every request, including each retry. nil means no limiting.
+	Limiter *HostLimiter
+	// Where Backfill, LatestPrices and the Sources fetch from. Empty fields use DefaultEndpoints.
+	Endpoints Endpoints
+}
+
+// NewClient returns a Client using httpClient, DefaultRetryPolicy and DefaultRateLimit.
+// nil gets a client with DefaultTimeout.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Client{
+		HTTP:    httpClient,
+		Retry:   DefaultRetryPolicy,
+		Limiter: NewHostLimiter(DefaultRateLimit),
+	}
+}
+
+// DefaultClient is used by the package level Parse functions and the built-in Sources.
+var DefaultClient = NewClient(nil)
+
+// Returns c, or DefaultClient if c is nil. Lets Sources leave their Client unset.
+func clientOrDefault(c *Client) *Client {
+	if c == nil {
+		return DefaultClient
+	}
+	return c
+}
+
+// GETs URL, retrying per c.Retry. Only 2xx responses are returned. Caller closes the body.
+func (c *Client) get(ctx context.Context, URL string) (*http.Response, error) {
+	var resp *http.Response
+	err := c.retry(ctx, URL, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
+		if err != nil {
+			return fmt.Errorf("error creating request: %w", err)
+		}
+
+		r, err := c.HTTP.Do(req)
+		if err != nil {
+			return err
+		}
+		if r.StatusCode < 200 || r.StatusCode > 299 {
+			body, _ := io.ReadAll(io.LimitReader(r.Body, 4096))
+			r.Body.Close()
+			return &UpstreamError{
+				Kind:        ErrUpstreamStatus,
+				URL:         URL,
+				Status:      r.StatusCode,
+				ContentType: r.Header.Get("Content-Type"),
+				Snippet:     snippet(body),
+				RetryAfter:  parseRetryAfter(r.Header.Get("Retry-After"), time.Now()),
+			}
+		}
+		resp = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// colly v1 has no context support so every request it makes gets ctx attached here.
+type ctxTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t ctxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
+
+// Builds a colly collector that shares c's transport and timeout and is cancelled with ctx.
+func (c *Client) collector(ctx context.Context) *colly.Collector {
+	collector := colly.NewCollector()
+
+	base := c.HTTP.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	collector.WithTransport(ctxTransport{ctx: ctx, base: base})
+	if c.HTTP.Timeout > 0 {
+		collector.SetRequestTimeout(c.HTTP.Timeout)
+	}
+	return collector
+}
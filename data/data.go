@@ -2,13 +2,15 @@ package data
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
-	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gocolly/colly"
 	// JSON struct is imported as pkg because it is used by multiple other pkgs.
@@ -31,7 +33,7 @@ import (
 //how to keep track of time last got make it so you limit times you do this
 // Don't want to keep running get new file every time.
 
-// Could reimplement this as interface I think?
+// NOTE: Each URL + Parse pair below is also wrapped as a Source in source.go.
 
 const (
 	//Possible issues using epoch time? Leap seconds?
@@ -55,41 +57,106 @@ type Transactions struct {
 	When    int64    `xml:"when"`
 }
 
+// Converts an xml <trans> block to the struct used for json and the db.
+func (t Transactions) toMarketTrans() structs.MarketTrans {
+	return structs.MarketTrans{
+		TransID: t.TransID,
+		ItemID:  t.ItemID,
+		Volume:  t.Vol,
+		Price:   t.Cost,
+		Time:    t.When,
+	}
+}
+
 // Creates URL that contains a dropdown box of all tradeable item names and ID in the HTML.
+// The URL* functions build from DefaultClient.Endpoints.
 func MarketURLItems() string {
-	return "https://g1wjmf0i0h.execute-api.us-east-2.amazonaws.com/default/itemindex"
+	return DefaultClient.Endpoints.MarketURLItems()
 }
 
 // Parses dropdown box for item ID and item name using colly to scrape.
-func MarketParseItems(URL string) ([]structs.Items, error) {
-	collector := colly.NewCollector()
+// Options without an itemid are skipped and listed in the ParseReport, Line
+// being the option's place in the dropdown.
+func MarketParseItems(ctx context.Context, URL string) ([]structs.Items, ParseReport, error) {
+	return DefaultClient.MarketParseItems(ctx, URL)
+}
 
+// MarketParseItems using c's transport. Cancelling ctx aborts the scrape.
+func (c *Client) MarketParseItems(ctx context.Context, URL string) ([]structs.Items, ParseReport, error) {
 	var itemList []structs.Items
-
-	collector.OnHTML("select[name=itemlist] option", func(h *colly.HTMLElement) {
-		//This returns the value attribute of <option value=""
-		urlString := h.Attr("value")
-
-		idString2Int, err := parseItemNumber(urlString)
-		if err != nil {
-			fmt.Printf("error parsing item number: %v", err)
-			return
+	var report ParseReport
+
+	// Each attempt needs a fresh collector since colly won't revisit a URL.
+	err := c.retry(ctx, URL, func(ctx context.Context) error {
+		itemList = nil
+		report = ParseReport{}
+		collector := c.collector(ctx)
+
+		// OnResponse runs before OnHTML so a bad payload is caught before scraping it.
+		var badPayload *UpstreamError
+		collector.OnResponse(func(r *colly.Response) {
+			contentType := r.Headers.Get("Content-Type")
+			switch {
+			case len(bytes.TrimSpace(r.Body)) == 0:
+				badPayload = &UpstreamError{Kind: ErrEmptyPayload, URL: URL, Status: r.StatusCode, ContentType: contentType}
+			case !strings.Contains(strings.ToLower(contentType), "html"):
+				// The API gateway sends back JSON when the lambda behind it falls over.
+				badPayload = &UpstreamError{Kind: ErrUnexpectedContentType, URL: URL, Status: r.StatusCode, ContentType: contentType, Snippet: snippet(r.Body)}
+			}
+		})
+
+		collector.OnHTML("select[name=itemlist] option", func(h *colly.HTMLElement) {
+			if badPayload != nil {
+				return
+			}
+			report.Lines++
+			//This returns the value attribute of <option value=""
+			urlString := h.Attr("value")
+
+			// Skip the option (ex. a blank "pick an item" one) instead of failing the whole list.
+			idString2Int, err := parseItemNumber(urlString)
+			if err != nil {
+				report.reject(report.Lines, h.Text, err.Error())
+				return
+			}
+
+			newItem := structs.Items{
+				//This returns the text inbetween <option></option>
+				Name: h.Text,
+				ID:   idString2Int,
+			}
+			itemList = append(itemList, newItem)
+		})
+
+		// colly turns bad statuses into a plain error. Keep the code so retry can classify it.
+		var status *UpstreamError
+		collector.OnError(func(r *colly.Response, err error) {
+			if r != nil && r.StatusCode != 0 {
+				status = &UpstreamError{Kind: ErrUpstreamStatus, URL: URL, Status: r.StatusCode, Snippet: snippet(r.Body)}
+				if r.Headers != nil {
+					status.ContentType = r.Headers.Get("Content-Type")
+					status.RetryAfter = parseRetryAfter(r.Headers.Get("Retry-After"), time.Now())
+				}
+			}
+		})
+
+		// This is where the "get" occurs. You predefine the actions then run the get.
+		if err := collector.Visit(URL); err != nil {
+			if status != nil {
+				return status
+			}
+			return fmt.Errorf("error colly visiting url: %w", err)
 		}
-
-		newItem := structs.Items{
-			//This returns the text inbetween <option></option>
-			Name: h.Text,
-			ID:   idString2Int,
+		if badPayload != nil {
+			return badPayload
 		}
-		itemList = append(itemList, newItem)
+		return nil
 	})
-
-	// This is where the "get" occurs. You predefine the actions then run the get.
-	if err := collector.Visit(URL); err != nil {
-		return nil, fmt.Errorf("error colly visiting url: %v", err)
+	if err != nil {
+		return nil, ParseReport{}, err
 	}
 
-	return itemList, nil
+	return itemList, report, nil
 }
 
 // Parses a url string to find the item number which is preceded by "itemid="
@@ -101,8 +168,11 @@ func parseItemNumber(urlString string) (int, error) {
 	}
 
 	//returns itemid=0000 slice where [0] is itemid=0000 and [1] is 0000
-	idStringNumber := reg.FindStringSubmatch(urlString)[1]
-	idNumber, err := strconv.Atoi(idStringNumber)
+	match := reg.FindStringSubmatch(urlString)
+	if match == nil {
+		return 0, fmt.Errorf("no itemid in %q", urlString)
+	}
+	idNumber, err := strconv.Atoi(match[1])
 	if err != nil {
 		return 0, fmt.Errorf("error converting str2int: %w", err)
 	}
@@ -112,56 +182,33 @@ func parseItemNumber(urlString string) (int, error) {
 // Creates URL that returns all transactions for itemid occuring in specified time frame on ColdFront.
 func MarketURLTransID(start int64, end int64, itemid string) string {
 	// The reason itemid is a string not int is because I need it to be "" sometimes.
-	return fmt.Sprintf("http://kol.coldfront.net/newmarket/export.php?start=%d&end=%d&itemid=%s", start, end, itemid)
+	return DefaultClient.Endpoints.MarketURLTransID(start, end, itemid)
 }
 
 // Creates URL that returns all transactions occuring in specified time frame on ColdFront.
 // NOTE: Simulates function overloading. Kinda feels weird doing this.
 func MarketURLTransAll(start int64, end int64) string {
-	//return fmt.Sprintf("http://kol.coldfront.net/newmarket/export.php?start=%d&end=%d&itemid=", start, end)
-	return MarketURLTransID(start, end, "")
+	return DefaultClient.Endpoints.MarketURLTransAll(start, end)
 }
 
 // Parses the ColdFront newmarket XML transaction data and returns to slice ready for json marshal.
-func MarketParseTrans(URL string) ([]structs.MarketTrans, error) {
-	// https://kol.coldfront.net/newmarket/export.php?start=1674968400&end=1674969465&itemid=
-	// Data is in XML format.
-	// Incoming data format: TransactionID: (ItemId Volume Cost Time)
-	resp, err := http.Get(URL)
-	if err != nil {
-		return nil, fmt.Errorf("error getting URL: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// ReadAll is used to put data into []byte
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading body to slice: %w", err)
-	}
-
-	// XML data is parsed and stored into Market struct based on the <tags>
-	var market Market
-	err = xml.Unmarshal(body, &market)
-	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling: %w", err)
-	}
+func MarketParseTrans(ctx context.Context, URL string) ([]structs.MarketTrans, error) {
+	return DefaultClient.MarketParseTrans(ctx, URL)
+}
 
-	// Now do stuff with market and create json from it.
+// MarketParseTrans using c's http.Client.
+// For big windows use MarketStreamTrans instead, this holds every row in memory.
+func (c *Client) MarketParseTrans(ctx context.Context, URL string) ([]structs.MarketTrans, error) {
 	// itemList slice is used to store each item xml block
 	var itemList []structs.MarketTrans
 
-	// Iterate through all the unmarshalled xml items.
-	for i := 0; i < len(market.Details); i++ {
-		// Create a new item from each market.Detail[i] item and creates a struct for it
-		newItem := structs.MarketTrans{
-			TransID: market.Details[i].TransID,
-			ItemID:  market.Details[i].ItemID,
-			Volume:  market.Details[i].Vol,
-			Price:   market.Details[i].Cost,
-			Time:    market.Details[i].When,
-		}
+	_, err := c.MarketStreamTrans(ctx, URL, func(trans structs.MarketTrans) error {
 		// Append new item for storage.
-		itemList = append(itemList, newItem)
+		itemList = append(itemList, trans)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return itemList, nil
@@ -169,96 +216,154 @@ func MarketParseTrans(URL string) ([]structs.MarketTrans, error) {
 
 // Creates URL that returns up to 10 itemid and its current price on ColdFront.
 func MarketURLPrices(itemIDs []int) (string, error) {
-	length := len(itemIDs)
-	// URL only allows max xof 10 items to be requested.
-	if length > 10 {
-		return "", fmt.Errorf("error, item slice len is %d. max 10 items\n", length)
-	}
-
-	URL := "https://kol.coldfront.net/newmarket/latestprice.php?"
-	for index, value := range itemIDs {
-		itemString := fmt.Sprintf("item%d=%d", index+1, value)
-		// If not last item in URL, needs &
-		if length-1 != index {
-			itemString += "&"
-		}
-		URL += itemString
-	}
-
-	return URL, nil
+	return DefaultClient.Endpoints.MarketURLPrices(itemIDs)
 }
 
 // Parses the ColdFront newmarket lastest item prices into usable format.
-func MarketParsePrices(URL string) ([]structs.MarketPrices, error) {
+// Lines that don't parse are skipped and listed in the ParseReport.
+func MarketParsePrices(ctx context.Context, URL string) ([]structs.MarketPrices, ParseReport, error) {
+	return DefaultClient.MarketParsePrices(ctx, URL)
+}
+
+// MarketParsePrices using c's http.Client.
+func (c *Client) MarketParsePrices(ctx context.Context, URL string) ([]structs.MarketPrices, ParseReport, error) {
 	// NOTE: Can reimplement using the net/html golang pkg instead.
 	// https://kol.coldfront.net/newmarket/latestprice.php?
 	// Data is just html.
 	// Incoming data format: "itemid,latestprice"<br>
-	resp, err := http.Get(URL)
+	respBody, err := c.getPayload(ctx, URL, acceptLines)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting URL: %w", err)
+		return nil, ParseReport{}, fmt.Errorf("failed getting URL: %w", err)
 	}
-	defer resp.Body.Close()
+	defer respBody.Close()
 
+	return parseMarketPrices(respBody)
+}
+
+func parseMarketPrices(r io.Reader) ([]structs.MarketPrices, ParseReport, error) {
 	var itemList []structs.MarketPrices
+	var report ParseReport
 
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
 	for scanner.Scan() {
+		lineNum++
+		raw := scanner.Text()
 		// Trims <br> from each line
-		line := strings.TrimRight(scanner.Text(), "<br>")
+		line := strings.TrimSuffix(strings.TrimSpace(raw), "<br>")
+		if line == "" {
+			continue
+		}
+		report.Lines++
+
 		// Splits into [itemid latestprice]
 		lineSlice := strings.Split(line, ",")
+		if len(lineSlice) != 2 {
+			report.reject(lineNum, raw, fmt.Sprintf("want 2 fields, got %d", len(lineSlice)))
+			continue
+		}
+
+		id, reason := positiveInt(strings.TrimSpace(lineSlice[0]), "itemid", strconv.IntSize)
+		if reason != "" {
+			report.reject(lineNum, raw, reason)
+			continue
+		}
+		price, reason := positiveInt(strings.TrimSpace(lineSlice[1]), "price", strconv.IntSize)
+		if reason != "" {
+			report.reject(lineNum, raw, reason)
+			continue
+		}
 
-		id, _ := strconv.Atoi(lineSlice[0])
-		price, _ := strconv.Atoi(lineSlice[1])
 		newItem := structs.MarketPrices{
-			ItemID: id,
-			Price:  price,
+			ItemID: int(id),
+			Price:  int(price),
 		}
 
 		itemList = append(itemList, newItem)
 	}
+	if err := scanner.Err(); err != nil {
+		return itemList, report, fmt.Errorf("error scanning body: %w", err)
+	}
 
-	return itemList, nil
+	return itemList, report, nil
 }
 
 // Creates and returns a URL string to kolmafia's item:time:price list.
 func MafiaURLPrices() string {
-	return "https://kolmafia.us/scripts/updateprices.php?action=getmap"
+	return DefaultClient.Endpoints.MafiaURLPrices()
 }
 
 // Parses the kolmafia's item:time:price data list into useable format.
-func MafiaParsePrices(URL string) ([]structs.MafiaPrices, error) {
+// Lines that don't parse are skipped and listed in the ParseReport.
+func MafiaParsePrices(ctx context.Context, URL string) ([]structs.MafiaPrices, ParseReport, error) {
+	return DefaultClient.MafiaParsePrices(ctx, URL)
+}
+
+// MafiaParsePrices using c's http.Client.
+func (c *Client) MafiaParsePrices(ctx context.Context, URL string) ([]structs.MafiaPrices, ParseReport, error) {
 	// https://kolmafia.us/scripts/updateprices.php?action=getmap
 	// Data is a pure txt file.
 	// Incoming data format: ItemId	TimeLastUpdated	Price(of the 5th item)
-	resp, err := http.Get(URL)
+	respBody, err := c.getPayload(ctx, URL, acceptLines)
 	if err != nil {
-		return nil, fmt.Errorf("failed getting URL: %w", err)
+		return nil, ParseReport{}, fmt.Errorf("failed getting URL: %w", err)
 	}
-	defer resp.Body.Close()
+	defer respBody.Close()
+
+	return parseMafiaPrices(respBody)
+}
 
+func parseMafiaPrices(r io.Reader) ([]structs.MafiaPrices, ParseReport, error) {
 	var itemList []structs.MafiaPrices
+	var report ParseReport
+
 	// Scanner used so I can parse line by line.
-	scanner := bufio.NewScanner(resp.Body)
+	scanner := bufio.NewScanner(r)
 	//Skipping the first line because it isn't needed
 	scanner.Scan()
+	lineNum := 1
 	for scanner.Scan() {
-		lineSlice := strings.Fields(scanner.Text())
+		lineNum++
+		raw := scanner.Text()
+		lineSlice := strings.Fields(raw)
+		if len(lineSlice) == 0 {
+			continue
+		}
+		report.Lines++
+
+		if len(lineSlice) != 3 {
+			report.reject(lineNum, raw, fmt.Sprintf("want 3 fields, got %d", len(lineSlice)))
+			continue
+		}
 
 		// Need to convert string to int so I can use for json. Also ParseInt since int64
-		id, _ := strconv.Atoi(lineSlice[0])
-		time, _ := strconv.ParseInt(lineSlice[1], 10, 64)
-		price, _ := strconv.Atoi(lineSlice[2])
+		id, reason := positiveInt(lineSlice[0], "itemid", strconv.IntSize)
+		if reason != "" {
+			report.reject(lineNum, raw, reason)
+			continue
+		}
+		updated, reason := positiveInt(lineSlice[1], "time", 64)
+		if reason != "" {
+			report.reject(lineNum, raw, reason)
+			continue
+		}
+		price, reason := positiveInt(lineSlice[2], "price", strconv.IntSize)
+		if reason != "" {
+			report.reject(lineNum, raw, reason)
+			continue
+		}
 
 		newItem := structs.MafiaPrices{
-			ItemID: id,
-			Time:   time,
-			Price:  price,
+			ItemID: int(id),
+			Time:   updated,
+			Price:  int(price),
 		}
 
 		itemList = append(itemList, newItem)
 	}
+	if err := scanner.Err(); err != nil {
+		return itemList, report, fmt.Errorf("error scanning body: %w", err)
+	}
 
-	return itemList, nil
+	return itemList, report, nil
 }
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+func TestParseMafiaPrices(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     []structs.MafiaPrices
+		lines    int
+		rejected []LineError
+	}{
+		{
+			name:  "good",
+			body:  "header\n194\t1700000000\t250\n895 1700000100 12\n",
+			want:  []structs.MafiaPrices{{ItemID: 194, Time: 1700000000, Price: 250}, {ItemID: 895, Time: 1700000100, Price: 12}},
+			lines: 2,
+		},
+		{
+			name: "header only",
+			body: "header\n",
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+		{
+			name:  "blank lines skipped",
+			body:  "header\n\n194\t1700000000\t250\n   \n",
+			want:  []structs.MafiaPrices{{ItemID: 194, Time: 1700000000, Price: 250}},
+			lines: 1,
+		},
+		{
+			name:     "short line",
+			body:     "header\n194\t1700000000\n",
+			lines:    1,
+			rejected: []LineError{{Line: 2, Text: "194\t1700000000", Reason: "want 3 fields, got 2"}},
+		},
+		{
+			name:     "long line",
+			body:     "header\n194\t1700000000\t250\t1\n",
+			lines:    1,
+			rejected: []LineError{{Line: 2, Text: "194\t1700000000\t250\t1", Reason: "want 3 fields, got 4"}},
+		},
+		{
+			name:     "zero price",
+			body:     "header\n194\t1700000000\t0\n",
+			lines:    1,
+			rejected: []LineError{{Line: 2, Text: "194\t1700000000\t0", Reason: "non-positive price 0"}},
+		},
+		{
+			name:     "zero itemid",
+			body:     "header\n0\t1700000000\t250\n",
+			lines:    1,
+			rejected: []LineError{{Line: 2, Text: "0\t1700000000\t250", Reason: "non-positive itemid 0"}},
+		},
+		{
+			name:     "non-numeric time",
+			body:     "header\n194\tyesterday\t250\n",
+			lines:    1,
+			rejected: []LineError{{Line: 2, Text: "194\tyesterday\t250", Reason: `bad time "yesterday"`}},
+		},
+		{
+			name:     "bad line among good ones",
+			body:     "header\n194\t1700000000\t250\nabc\t1\t2\n895\t1700000100\t12\n",
+			want:     []structs.MafiaPrices{{ItemID: 194, Time: 1700000000, Price: 250}, {ItemID: 895, Time: 1700000100, Price: 12}},
+			lines:    3,
+			rejected: []LineError{{Line: 3, Text: "abc\t1\t2", Reason: `bad itemid "abc"`}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report, err := parseMafiaPrices(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("parseMafiaPrices() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMafiaPrices() = %v, want %v", got, tt.want)
+			}
+			if report.Lines != tt.lines {
+				t.Errorf("report.Lines = %d, want %d", report.Lines, tt.lines)
+			}
+			if !reflect.DeepEqual(report.Rejected, tt.rejected) {
+				t.Errorf("report.Rejected = %v, want %v", report.Rejected, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestParseMarketPrices(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     []structs.MarketPrices
+		lines    int
+		rejected []LineError
+	}{
+		{
+			name:  "good",
+			body:  "194,250<br>\n895, 12<br>\n",
+			want:  []structs.MarketPrices{{ItemID: 194, Price: 250}, {ItemID: 895, Price: 12}},
+			lines: 2,
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+		{
+			name:  "blank lines skipped",
+			body:  "\n<br>\n194,250<br>\n",
+			want:  []structs.MarketPrices{{ItemID: 194, Price: 250}},
+			lines: 1,
+		},
+		{
+			name:     "short line",
+			body:     "194<br>\n",
+			lines:    1,
+			rejected: []LineError{{Line: 1, Text: "194<br>", Reason: "want 2 fields, got 1"}},
+		},
+		{
+			name:     "zero price",
+			body:     "194,0<br>\n",
+			lines:    1,
+			rejected: []LineError{{Line: 1, Text: "194,0<br>", Reason: "non-positive price 0"}},
+		},
+		{
+			name:     "negative itemid",
+			body:     "-1,250<br>\n",
+			lines:    1,
+			rejected: []LineError{{Line: 1, Text: "-1,250<br>", Reason: "non-positive itemid -1"}},
+		},
+		{
+			name:     "non-numeric price",
+			body:     "194,n/a<br>\n",
+			lines:    1,
+			rejected: []LineError{{Line: 1, Text: "194,n/a<br>", Reason: `bad price "n/a"`}},
+		},
+		{
+			name:     "bad line among good ones",
+			body:     "194,250<br>\nbad<br>\n895,12<br>\n",
+			want:     []structs.MarketPrices{{ItemID: 194, Price: 250}, {ItemID: 895, Price: 12}},
+			lines:    3,
+			rejected: []LineError{{Line: 2, Text: "bad<br>", Reason: "want 2 fields, got 1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report, err := parseMarketPrices(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("parseMarketPrices() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMarketPrices() = %v, want %v", got, tt.want)
+			}
+			if report.Lines != tt.lines {
+				t.Errorf("report.Lines = %d, want %d", report.Lines, tt.lines)
+			}
+			if !reflect.DeepEqual(report.Rejected, tt.rejected) {
+				t.Errorf("report.Rejected = %v, want %v", report.Rejected, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestParseItemNumber(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "https://kol.coldfront.net/newmarket/itemindex.php?itemid=194", want: 194},
+		{value: "itemid=895&x=1", want: 895},
+		{value: "", wantErr: true},
+		{value: "https://kol.coldfront.net/newmarket/", wantErr: true},
+		{value: "itemid=", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseItemNumber(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseItemNumber(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseItemNumber(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMarketParseItems(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><select name="itemlist">
+<option value="">pick an item</option>
+<option value="itemindex.php?itemid=194">Mr. Accessory</option>
+<option value="itemindex.php?itemid=895">hair spray</option>
+</select></body></html>`))
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTP: srv.Client()}
+	items, report, err := client.MarketParseItems(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("MarketParseItems() error = %v", err)
+	}
+	if want := []structs.Items{{ID: 194, Name: "Mr. Accessory"}, {ID: 895, Name: "hair spray"}}; !reflect.DeepEqual(items, want) {
+		t.Errorf("MarketParseItems() = %v, want %v", items, want)
+	}
+	if report.Lines != 3 || len(report.Rejected) != 1 || report.Rejected[0].Line != 1 || report.Rejected[0].Text != "pick an item" {
+		t.Errorf("MarketParseItems() report = %+v, want the blank option rejected", report)
+	}
+}
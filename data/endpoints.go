@@ -0,0 +1,84 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Endpoints are the upstream URLs every Market/Mafia URL is built from.
+// Point them at a mirror, caching proxy or local fake server to avoid the real hosts.
+type Endpoints struct {
+	// Full URL of the item index page.
+	Items string
+	// ColdFront newmarket base. export.php and latestprice.php are added to it.
+	ColdFront string
+	// Full URL of kolmafia's updateprices.php. action=getmap is added to it.
+	Mafia string
+}
+
+// DefaultEndpoints are the real hosts.
+var DefaultEndpoints = Endpoints{
+	Items:     "https://g1wjmf0i0h.execute-api.us-east-2.amazonaws.com/default/itemindex",
+	ColdFront: "https://kol.coldfront.net/newmarket",
+	Mafia:     "https://kolmafia.us/scripts/updateprices.php",
+}
+
+// Any field left empty uses DefaultEndpoints.
+func (e Endpoints) orDefault() Endpoints {
+	if e.Items == "" {
+		e.Items = DefaultEndpoints.Items
+	}
+	if e.ColdFront == "" {
+		e.ColdFront = DefaultEndpoints.ColdFront
+	}
+	if e.Mafia == "" {
+		e.Mafia = DefaultEndpoints.Mafia
+	}
+	return e
+}
+
+// Adds a query string to URL whether or not it already has one.
+func withQuery(URL string, query string) string {
+	if strings.Contains(URL, "?") {
+		return URL + "&" + query
+	}
+	return URL + "?" + query
+}
+
+// MarketURLItems is the item index page URL.
+func (e Endpoints) MarketURLItems() string {
+	return e.orDefault().Items
+}
+
+// MarketURLTransID is ColdFront's export of itemid's transactions from start to end.
+// "" itemid is every item.
+func (e Endpoints) MarketURLTransID(start int64, end int64, itemid string) string {
+	base := strings.TrimSuffix(e.orDefault().ColdFront, "/")
+	return withQuery(base+"/export.php", fmt.Sprintf("start=%d&end=%d&itemid=%s", start, end, itemid))
+}
+
+// MarketURLTransAll is MarketURLTransID for every item.
+func (e Endpoints) MarketURLTransAll(start int64, end int64) string {
+	return e.MarketURLTransID(start, end, "")
+}
+
+// MarketURLPrices is ColdFront's latest price of up to MaxPriceItems items.
+func (e Endpoints) MarketURLPrices(itemIDs []int) (string, error) {
+	length := len(itemIDs)
+	// URL only allows max xof 10 items to be requested. LatestPrices splits bigger lists.
+	if length > MaxPriceItems {
+		return "", fmt.Errorf("error, item slice len is %d. max %d items\n", length, MaxPriceItems)
+	}
+
+	items := make([]string, length)
+	for index, value := range itemIDs {
+		items[index] = fmt.Sprintf("item%d=%d", index+1, value)
+	}
+	base := strings.TrimSuffix(e.orDefault().ColdFront, "/")
+	return withQuery(base+"/latestprice.php", strings.Join(items, "&")), nil
+}
+
+// MafiaURLPrices is kolmafia's item:time:price list.
+func (e Endpoints) MafiaURLPrices() string {
+	return withQuery(e.orDefault().Mafia, "action=getmap")
+}
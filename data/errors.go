@@ -0,0 +1,125 @@
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Kinds of bad upstream response. Check with errors.Is, then errors.As an
+// *UpstreamError for the details.
+var (
+	ErrUpstreamStatus        = errors.New("unexpected upstream status")
+	ErrUnexpectedContentType = errors.New("unexpected upstream content type")
+	ErrEmptyPayload          = errors.New("empty upstream payload")
+)
+
+// How much of a bad body is kept in UpstreamError.Snippet.
+const snippetLen = 200
+
+// UpstreamError is a response that came back but isn't something the parsers
+// can use (ex. ColdFront's HTML error page). Kind is one of the Err vars above.
+type UpstreamError struct {
+	Kind        error
+	URL         string
+	Status      int
+	ContentType string
+	Snippet     string
+	// From the Retry-After header. 0 if missing.
+	RetryAfter time.Duration
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%v: %s (status %d, content-type %q): %q", e.Kind, e.URL, e.Status, e.ContentType, e.Snippet)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Kind
+}
+
+// Trims body down to something readable for an error message.
+func snippet(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > snippetLen {
+		body = body[:snippetLen]
+	}
+	return string(body)
+}
+
+// acceptFunc says if a response with mediaType (lowercase, no params) and the
+// first bytes of its body is the format a parser expects.
+type acceptFunc func(mediaType string, head []byte) bool
+
+// ColdFront export.php. XML, though the header isn't always set right so sniff too.
+func acceptXML(mediaType string, head []byte) bool {
+	if strings.Contains(mediaType, "xml") {
+		return true
+	}
+	head = bytes.TrimSpace(head)
+	return bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<marketplace"))
+}
+
+// latestprice.php and updateprices.php. Plain lines served as text/*, but never a full HTML page.
+func acceptLines(mediaType string, head []byte) bool {
+	if mediaType != "" && !strings.HasPrefix(mediaType, "text/") {
+		return false
+	}
+	return !looksLikeHTMLPage(head)
+}
+
+// Error pages start with a doctype or <html>. The latest price feed has <br>s so can't just look for tags.
+func looksLikeHTMLPage(head []byte) bool {
+	head = bytes.ToLower(bytes.TrimSpace(head))
+	return bytes.HasPrefix(head, []byte("<!doctype html")) ||
+		bytes.HasPrefix(head, []byte("<html")) ||
+		bytes.Contains(head, []byte("<body"))
+}
+
+// A validated response body. Reads come from the buffered reader so the peeked bytes aren't lost.
+type payloadBody struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// GETs URL and checks the body isn't empty and looks like what accept wants.
+// Caller closes the returned body.
+func (c *Client) getPayload(ctx context.Context, URL string, accept acceptFunc) (io.ReadCloser, error) {
+	resp, err := c.get(ctx, URL)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	reader := bufio.NewReader(resp.Body)
+	// Peek doesn't consume, so the parsers still get the whole body.
+	head, err := reader.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error reading body: %w", err)
+	}
+
+	if len(bytes.TrimSpace(head)) == 0 {
+		resp.Body.Close()
+		return nil, &UpstreamError{Kind: ErrEmptyPayload, URL: URL, Status: resp.StatusCode, ContentType: contentType}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !accept(strings.ToLower(mediaType), head) {
+		resp.Body.Close()
+		return nil, &UpstreamError{
+			Kind:        ErrUnexpectedContentType,
+			URL:         URL,
+			Status:      resp.StatusCode,
+			ContentType: contentType,
+			Snippet:     snippet(head),
+		}
+	}
+
+	return payloadBody{Reader: reader, Closer: resp.Body}, nil
+}
@@ -0,0 +1,47 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		want        error
+	}{
+		{"bad status", http.StatusInternalServerError, "text/html", "<html>oops</html>", ErrUpstreamStatus},
+		{"html error page", http.StatusOK, "text/html", "<!DOCTYPE html><html><body>down</body></html>", ErrUnexpectedContentType},
+		{"json from the gateway", http.StatusOK, "application/json", `{"message": "Internal server error"}`, ErrUnexpectedContentType},
+		{"empty", http.StatusOK, "text/plain", "  \n", ErrEmptyPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client := &Client{HTTP: srv.Client(), Retry: RetryPolicy{MaxAttempts: 1}}
+			_, _, err := client.MafiaParsePrices(context.Background(), srv.URL)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("MafiaParsePrices() error = %v, want %v", err, tt.want)
+			}
+			var upstream *UpstreamError
+			if !errors.As(err, &upstream) {
+				t.Fatalf("MafiaParsePrices() error = %v, want an *UpstreamError", err)
+			}
+			if upstream.Status != tt.status || upstream.ContentType != tt.contentType || upstream.URL != srv.URL {
+				t.Errorf("UpstreamError = %+v, want status %d and content type %q for %s", upstream, tt.status, tt.contentType, srv.URL)
+			}
+		})
+	}
+}
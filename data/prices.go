@@ -0,0 +1,88 @@
+package data
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// MaxPriceItems is the most item IDs latestprice.php takes in one request.
+const MaxPriceItems = 10
+
+// LatestPricesResult is the merged output of every chunk LatestPrices fetched.
+type LatestPricesResult struct {
+	Prices []structs.MarketPrices
+	// Asked for but not in any response, including IDs from chunks that failed.
+	Missing []int
+	Report  ParseReport
+}
+
+// LatestPrices gets the ColdFront latest price for any number of item IDs by
+// splitting them into MaxPriceItems sized requests.
+func LatestPrices(ctx context.Context, ids []int) (LatestPricesResult, error) {
+	return DefaultClient.LatestPrices(ctx, ids)
+}
+
+// LatestPrices using c. Chunks go out one at a time through c's rate limiter.
+// A failed chunk doesn't stop the rest. Its IDs end up in Missing and the
+// returned error says how many chunks failed.
+func (c *Client) LatestPrices(ctx context.Context, ids []int) (LatestPricesResult, error) {
+	var result LatestPricesResult
+
+	// Duplicates would just waste a slot in the 10 item URL.
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	found := make(map[int]bool, len(unique))
+	failed := 0
+	var firstErr error
+	for i := 0; i < len(unique); i += MaxPriceItems {
+		end := i + MaxPriceItems
+		if end > len(unique) {
+			end = len(unique)
+		}
+
+		URL, err := c.Endpoints.MarketURLPrices(unique[i:end])
+		if err == nil {
+			var prices []structs.MarketPrices
+			var report ParseReport
+			prices, report, err = c.MarketParsePrices(ctx, URL)
+			result.Report.Merge(report)
+			for _, price := range prices {
+				// Only keep what we asked for, and only once.
+				if seen[price.ItemID] && !found[price.ItemID] {
+					found[price.ItemID] = true
+					result.Prices = append(result.Prices, price)
+				}
+			}
+		}
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+
+	for _, id := range unique {
+		if !found[id] {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+
+	if failed > 0 {
+		chunks := (len(unique) + MaxPriceItems - 1) / MaxPriceItems
+		return result, fmt.Errorf("error LatestPrices %d of %d chunk(s) failed: %w", failed, chunks, firstErr)
+	}
+	return result, nil
+}
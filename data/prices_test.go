@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Answers latestprice.php with price id*10 for every item asked for, except skip.
+// Returns the item IDs of each request.
+func pricesServer(t *testing.T, skip int) (*Client, *[][]int) {
+	var mu sync.Mutex
+	var requests [][]int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ids []int
+		for i := 1; ; i++ {
+			value := r.URL.Query().Get(fmt.Sprintf("item%d", i))
+			if value == "" {
+				break
+			}
+			id, _ := strconv.Atoi(value)
+			ids = append(ids, id)
+		}
+		mu.Lock()
+		requests = append(requests, ids)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		for _, id := range ids {
+			if id != skip {
+				fmt.Fprintf(w, "%d,%d<br>\n", id, id*10)
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{HTTP: srv.Client(), Endpoints: Endpoints{ColdFront: srv.URL}}, &requests
+}
+
+func TestLatestPricesChunks(t *testing.T) {
+	client, requests := pricesServer(t, 7)
+	var ids []int
+	for id := 1; id <= 25; id++ {
+		ids = append(ids, id)
+	}
+	// Duplicates don't take up a slot.
+	ids = append(ids, 1, 2)
+
+	result, err := client.LatestPrices(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("LatestPrices() error = %v", err)
+	}
+
+	var sizes []int
+	for _, request := range *requests {
+		sizes = append(sizes, len(request))
+	}
+	if want := []int{10, 10, 5}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("LatestPrices() request sizes = %v, want %v", sizes, want)
+	}
+
+	var got []int
+	for _, price := range result.Prices {
+		if price.Price != price.ItemID*10 {
+			t.Errorf("LatestPrices() price %+v, want %d", price, price.ItemID*10)
+		}
+		got = append(got, price.ItemID)
+	}
+	sort.Ints(got)
+	if len(got) != 24 || got[6] != 8 {
+		t.Errorf("LatestPrices() items = %v, want 1-25 without 7", got)
+	}
+	if want := []int{7}; !reflect.DeepEqual(result.Missing, want) {
+		t.Errorf("LatestPrices() Missing = %v, want %v", result.Missing, want)
+	}
+}
+
+func TestLatestPricesNoIDs(t *testing.T) {
+	client, requests := pricesServer(t, 0)
+	result, err := client.LatestPrices(context.Background(), nil)
+	if err != nil || len(result.Prices) != 0 || len(*requests) != 0 {
+		t.Errorf("LatestPrices(nil) = %+v, %v after %d request(s), want nothing", result, err, len(*requests))
+	}
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: PerSecond tokens refill, up to Burst saved up.
+// PerSecond <= 0 means no limit.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+// DefaultRateLimit is one request per 5 seconds per host, the same spacing
+// TempTestData used to get with time.Sleep.
+var DefaultRateLimit = RateLimit{PerSecond: 0.2, Burst: 1}
+
+// HostLimiter keeps one token bucket per upstream host so a backfill against
+// ColdFront doesn't slow down kolmafia.us and vice versa.
+type HostLimiter struct {
+	mu           sync.Mutex
+	defaultLimit RateLimit
+	limits       map[string]RateLimit
+	buckets      map[string]*bucket
+}
+
+// NewHostLimiter returns a HostLimiter applying limit to every host without its own SetLimit.
+func NewHostLimiter(limit RateLimit) *HostLimiter {
+	return &HostLimiter{
+		defaultLimit: limit,
+		limits:       map[string]RateLimit{},
+		buckets:      map[string]*bucket{},
+	}
+}
+
+// SetLimit overrides the limit for one host (ex. "kol.coldfront.net").
+func (h *HostLimiter) SetLimit(host string, limit RateLimit) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limits[host] = limit
+	// Start the host over so the new burst applies right away.
+	delete(h.buckets, host)
+}
+
+// Wait blocks until host has a token or ctx is done.
+func (h *HostLimiter) Wait(ctx context.Context, host string) error {
+	h.mu.Lock()
+	b, ok := h.buckets[host]
+	if !ok {
+		limit, ok := h.limits[host]
+		if !ok {
+			limit = h.defaultLimit
+		}
+		b = newBucket(limit)
+		h.buckets[host] = b
+	}
+	delay := b.reserve(time.Now())
+	h.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// Never used the token, give it back.
+		h.mu.Lock()
+		b.tokens++
+		h.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(limit RateLimit) *bucket {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+	return &bucket{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+}
+
+// Takes a token and returns how long to wait before using it. Tokens can go
+// negative so concurrent callers queue up behind each other instead of racing.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if b.limit.PerSecond <= 0 {
+		return 0
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.PerSecond
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.limit.PerSecond * float64(time.Second))
+}
+
+// Waits for URL's host on c.Limiter. A nil Limiter never waits.
+func (c *Client) waitTurn(ctx context.Context, URL string) error {
+	if c.Limiter == nil {
+		return nil
+	}
+	u, err := url.Parse(URL)
+	if err != nil {
+		return fmt.Errorf("error parsing URL for rate limit: %w", err)
+	}
+	return c.Limiter.Wait(ctx, u.Host)
+}
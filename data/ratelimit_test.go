@@ -0,0 +1,61 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketReserve(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tests := []struct {
+		name  string
+		limit RateLimit
+		// Reserve times and the wait each should get.
+		calls []time.Time
+		waits []time.Duration
+	}{
+		{
+			name:  "off",
+			limit: RateLimit{PerSecond: 0},
+			calls: []time.Time{at(0), at(0), at(0)},
+			waits: []time.Duration{0, 0, 0},
+		},
+		{
+			name:  "burst then queue",
+			limit: RateLimit{PerSecond: 2, Burst: 2},
+			calls: []time.Time{at(0), at(0), at(0), at(0)},
+			waits: []time.Duration{0, 0, 500 * time.Millisecond, time.Second},
+		},
+		{
+			name:  "refills over time",
+			limit: RateLimit{PerSecond: 1, Burst: 1},
+			calls: []time.Time{at(0), at(0), at(2 * time.Second)},
+			waits: []time.Duration{0, time.Second, 0},
+		},
+		{
+			name:  "refill capped at burst",
+			limit: RateLimit{PerSecond: 1, Burst: 2},
+			calls: []time.Time{at(time.Hour), at(time.Hour), at(time.Hour)},
+			waits: []time.Duration{0, 0, time.Second},
+		},
+		{
+			name:  "burst under 1 is 1",
+			limit: RateLimit{PerSecond: 4, Burst: 0},
+			calls: []time.Time{at(0), at(0)},
+			waits: []time.Duration{0, 250 * time.Millisecond},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(tt.limit)
+			b.last = start
+			for i, now := range tt.calls {
+				if got := b.reserve(now); got != tt.waits[i] {
+					t.Errorf("reserve() call %d = %v, want %v", i, got, tt.waits[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// LineError is one line a parser threw out.
+type LineError struct {
+	// 1 based, counting the header line if the feed has one.
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (e LineError) String() string {
+	return fmt.Sprintf("line %d: %s: %q", e.Line, e.Reason, e.Text)
+}
+
+// ParseReport says how many lines (item list options for MarketParseItems) a
+// parser looked at and which ones it rejected. Good rows are still returned alongside it.
+type ParseReport struct {
+	// Non blank data lines looked at. Header lines aren't counted.
+	Lines    int
+	Rejected []LineError
+}
+
+// Accepted is the number of lines that became rows.
+func (r ParseReport) Accepted() int {
+	return r.Lines - len(r.Rejected)
+}
+
+// Merge adds other's counts and rejects onto r. Used when one logical fetch is several requests.
+func (r *ParseReport) Merge(other ParseReport) {
+	r.Lines += other.Lines
+	r.Rejected = append(r.Rejected, other.Rejected...)
+}
+
+func (r *ParseReport) reject(line int, text string, reason string) {
+	r.Rejected = append(r.Rejected, LineError{Line: line, Text: text, Reason: reason})
+}
+
+// Parses a field that must be a positive int that fits in bitSize.
+// Returns the reject reason, or "" if it's fine. name is only for the reason.
+func positiveInt(field string, name string, bitSize int) (int64, string) {
+	n, err := strconv.ParseInt(field, 10, bitSize)
+	if err != nil {
+		return 0, fmt.Sprintf("bad %s %q", name, field)
+	}
+	// 0 means the conversion would have failed silently before, never a real value.
+	if n <= 0 {
+		return 0, fmt.Sprintf("non-positive %s %d", name, n)
+	}
+	return n, ""
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how many times and how slowly a failed fetch is retried.
+// Delays double each attempt starting at BaseDelay and are capped at MaxDelay.
+type RetryPolicy struct {
+	// Total tries including the first. 0 or 1 means no retries.
+	MaxAttempts int
+	// 0 retries straight away.
+	BaseDelay time.Duration
+	// Also caps an upstream's Retry-After. 0 for no cap.
+	MaxDelay time.Duration
+	// Fraction (0-1) of each delay that is randomised so retries don't line up.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is what NewClient uses. ColdFront usually recovers within a few seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	Jitter:      0.5,
+}
+
+// How long to wait after the given (1 based) failed attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	// Past 30 doublings the shift overflows.
+	if attempt > 30 || delay < p.BaseDelay {
+		delay = time.Duration(math.MaxInt64)
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// RetryError is returned once a fetch gives up. Err is the last attempt's error.
+type RetryError struct {
+	URL      string
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("error fetching %s after %d attempt(s): %v", e.URL, e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// Status codes that are worth asking again for.
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooEarly,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Parses a Retry-After header, which is either delay seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil && when.After(now) {
+		return when.Sub(now)
+	}
+	return 0
+}
+
+// Decides if err from an attempt is worth retrying.
+func retryable(ctx context.Context, err error) bool {
+	// Our own cancellation/deadline. Stop right away.
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var ue *UpstreamError
+	if errors.As(err, &ue) {
+		return ue.Kind == ErrUpstreamStatus && retryableStatus(ue.Status)
+	}
+
+	// http.Client.Do wraps every error in a *url.Error, including ones another try
+	// won't fix (bad scheme, TLS). Look at what it wraps.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	// Timeouts (http.Client.Timeout too), refused or reset connections and dropped bodies.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Runs attempt until it succeeds, fails with a non retryable error, or c.Retry runs out.
+// Each attempt waits its turn on c.Limiter first.
+// Every error returned is a *RetryError so callers can see how many tries it took.
+func (c *Client) retry(ctx context.Context, URL string, attempt func(ctx context.Context) error) error {
+	maxAttempts := c.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	for n := 1; ; n++ {
+		err := c.waitTurn(ctx, URL)
+		if err == nil {
+			err = attempt(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		if n >= maxAttempts || !retryable(ctx, err) {
+			return &RetryError{URL: URL, Attempts: n, Err: err}
+		}
+
+		wait := c.Retry.backoff(n)
+		// Upstream told us how long to back off. Honor it if it's longer than ours,
+		// up to MaxDelay so one header can't hold a daemon job up for hours.
+		var ue *UpstreamError
+		if errors.As(err, &ue) && ue.RetryAfter > wait {
+			wait = ue.RetryAfter
+			if c.Retry.MaxDelay > 0 && wait > c.Retry.MaxDelay {
+				wait = c.Retry.MaxDelay
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &RetryError{URL: URL, Attempts: n, Err: err}
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first", RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}, 1, time.Second},
+		{"doubles", RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}, 3, 4 * time.Second},
+		{"capped", RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}, 6, 30 * time.Second},
+		{"shift overflow", RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}, 64, 30 * time.Second},
+		{"no base delay", RetryPolicy{BaseDelay: 0, MaxDelay: 30 * time.Second}, 1, 0},
+		{"no base delay later", RetryPolicy{BaseDelay: 0, MaxDelay: 30 * time.Second}, 5, 0},
+		{"no max delay", RetryPolicy{BaseDelay: time.Second}, 4, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.backoff(tt.attempt); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(2); got > 2*time.Second || got < time.Second {
+			t.Fatalf("backoff(2) = %v, want between 1s and 2s", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 2, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+// Answers with statuses in order, then 200s. Returns how many requests it got.
+func statusServer(t *testing.T, retryAfter string, statuses ...int) (*Client, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&requests, 1))
+		if n <= len(statuses) {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+	return &Client{HTTP: srv.Client(), Retry: RetryPolicy{MaxAttempts: 3}, Endpoints: Endpoints{ColdFront: srv.URL}}, &requests
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int32
+		wantErr  bool
+	}{
+		{"first try", nil, 1, false},
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusBadGateway}, 3, false},
+		{"gives up", []int{503, 503, 503, 503}, 3, true},
+		{"not retryable", []int{http.StatusNotFound}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, requests := statusServer(t, "", tt.statuses...)
+			resp, err := client.get(context.Background(), client.Endpoints.ColdFront+"/")
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if got := atomic.LoadInt32(requests); got != tt.want {
+				t.Errorf("get() made %d request(s), want %d", got, tt.want)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("get() error = %v, want error %v", err, tt.wantErr)
+			}
+			var retryErr *RetryError
+			if err != nil && (!errors.As(err, &retryErr) || retryErr.Attempts != int(tt.want)) {
+				t.Errorf("get() error = %v, want a *RetryError after %d attempt(s)", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryHonorsRetryAfterUpToMaxDelay(t *testing.T) {
+	client, requests := statusServer(t, "3600", http.StatusTooManyRequests)
+	client.Retry.MaxDelay = 50 * time.Millisecond
+
+	began := time.Now()
+	resp, err := client.get(context.Background(), client.Endpoints.ColdFront+"/")
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	resp.Body.Close()
+	// No BaseDelay, so the only wait is Retry-After's, cut down to MaxDelay.
+	if took := time.Since(began); took < 50*time.Millisecond || took > 5*time.Second {
+		t.Errorf("get() took %v, want about MaxDelay", took)
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("get() made %d request(s), want 2", got)
+	}
+}
+
+func TestRetrySkipsPermanentErrors(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	tests := []struct {
+		name string
+		URL  string
+	}{
+		{"unsupported scheme", "ftp://example.invalid/x"},
+		// http.Client doesn't trust httptest's certificate.
+		{"bad certificate", tlsServer.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{HTTP: &http.Client{}, Retry: RetryPolicy{MaxAttempts: 4}}
+			_, err := client.get(context.Background(), tt.URL)
+			var retryErr *RetryError
+			if !errors.As(err, &retryErr) {
+				t.Fatalf("get() error = %v, want a *RetryError", err)
+			}
+			if retryErr.Attempts != 1 {
+				t.Errorf("get() made %d attempt(s), want 1: %v", retryErr.Attempts, err)
+			}
+		})
+	}
+}
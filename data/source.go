@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// Kind says which of the Batch slices a Source fills in.
+type Kind string
+
+const (
+	KindItems        Kind = "items"
+	KindTrans        Kind = "trans"
+	KindMarketPrices Kind = "prices"
+	KindMafiaPrices  Kind = "mafia"
+)
+
+// Window is a [Start, End) range of epoch seconds. Sources that always return
+// a full snapshot (items, mafia prices) ignore it.
+type Window struct {
+	Start int64
+	End   int64
+}
+
+// Fills in a zero window as the last EpochDay ending now.
+func (w Window) orLastDay() Window {
+	if w.End == 0 {
+		w.End = time.Now().Unix()
+	}
+	if w.Start == 0 {
+		w.Start = w.End - EpochDay
+	}
+	return w
+}
+
+// Batch holds whatever a Source fetched. Only the slice matching the Source's Kind is set.
+type Batch struct {
+	Items        []structs.Items
+	Trans        []structs.MarketTrans
+	MarketPrices []structs.MarketPrices
+	MafiaPrices  []structs.MafiaPrices
+	// Rejected lines (prices, mafia) or item list options (items). Empty for trans.
+	Report ParseReport
+}
+
+// Len returns the number of rows in the Batch regardless of Kind.
+func (b Batch) Len() int {
+	return len(b.Items) + len(b.Trans) + len(b.MarketPrices) + len(b.MafiaPrices)
+}
+
+// Source is one upstream feed. It wraps a URL builder + parser pair so callers
+// don't have to wire them by hand.
+type Source interface {
+	Name() string
+	Kind() Kind
+	Fetch(ctx context.Context, window Window) (Batch, error)
+}
+
+// Options are what a fetch needs besides its Window. Sources ignore the ones they don't use.
+type Options struct {
+	// nil uses DefaultClient.
+	Client *Client
+	// Only this item. TransSource.
+	ItemID string
+	// These items. MarketPricesSource.
+	ItemIDs []int
+}
+
+// Configurable is a Source that takes Options.
+type Configurable interface {
+	Source
+	// With returns a copy set up with opts.
+	With(opts Options) Source
+}
+
+// Configure returns src set up with opts, or src as is if it doesn't take Options.
+func Configure(src Source, opts Options) Source {
+	if c, ok := src.(Configurable); ok {
+		return c.With(opts)
+	}
+	return src
+}
+
+// ItemsSource is the ColdFront tradeable item list.
+type ItemsSource struct {
+	// nil uses DefaultClient. Same for the other Sources.
+	Client *Client
+}
+
+func (ItemsSource) Name() string { return "coldfront-items" }
+func (ItemsSource) Kind() Kind   { return KindItems }
+
+func (s ItemsSource) With(opts Options) Source {
+	s.Client = opts.Client
+	return s
+}
+
+func (s ItemsSource) Fetch(ctx context.Context, window Window) (Batch, error) {
+	client := clientOrDefault(s.Client)
+	items, report, err := client.MarketParseItems(ctx, client.Endpoints.MarketURLItems())
+	if err != nil {
+		return Batch{}, err
+	}
+	return Batch{Items: items, Report: report}, nil
+}
+
+// TransSource is the ColdFront transaction export. Empty ItemID means all items.
+type TransSource struct {
+	Client *Client
+	ItemID string
+}
+
+func (TransSource) Name() string { return "coldfront-trans" }
+func (TransSource) Kind() Kind   { return KindTrans }
+
+func (s TransSource) With(opts Options) Source {
+	s.Client, s.ItemID = opts.Client, opts.ItemID
+	return s
+}
+
+func (s TransSource) Fetch(ctx context.Context, window Window) (Batch, error) {
+	window = window.orLastDay()
+	client := clientOrDefault(s.Client)
+	trans, err := client.MarketParseTrans(ctx, client.Endpoints.MarketURLTransID(window.Start, window.End, s.ItemID))
+	if err != nil {
+		return Batch{}, err
+	}
+	return Batch{Trans: trans}, nil
+}
+
+// MarketPricesSource is the ColdFront latest price feed for ItemIDs. Any number
+// of IDs is fine, they're fetched MaxPriceItems at a time.
+type MarketPricesSource struct {
+	Client  *Client
+	ItemIDs []int
+}
+
+func (MarketPricesSource) Name() string { return "coldfront-prices" }
+func (MarketPricesSource) Kind() Kind   { return KindMarketPrices }
+
+func (s MarketPricesSource) With(opts Options) Source {
+	s.Client, s.ItemIDs = opts.Client, opts.ItemIDs
+	return s
+}
+
+func (s MarketPricesSource) Fetch(ctx context.Context, window Window) (Batch, error) {
+	// Nothing to ask for. Not an error so generic loops over Sources() still work.
+	if len(s.ItemIDs) == 0 {
+		return Batch{}, nil
+	}
+	result, err := clientOrDefault(s.Client).LatestPrices(ctx, s.ItemIDs)
+	if err != nil {
+		return Batch{}, err
+	}
+	return Batch{MarketPrices: result.Prices, Report: result.Report}, nil
+}
+
+// MafiaPricesSource is kolmafia's item:time:price list.
+type MafiaPricesSource struct {
+	Client *Client
+}
+
+func (MafiaPricesSource) Name() string { return "kolmafia-prices" }
+func (MafiaPricesSource) Kind() Kind   { return KindMafiaPrices }
+
+func (s MafiaPricesSource) With(opts Options) Source {
+	s.Client = opts.Client
+	return s
+}
+
+func (s MafiaPricesSource) Fetch(ctx context.Context, window Window) (Batch, error) {
+	client := clientOrDefault(s.Client)
+	prices, report, err := client.MafiaParsePrices(ctx, client.Endpoints.MafiaURLPrices())
+	if err != nil {
+		return Batch{}, err
+	}
+	return Batch{MafiaPrices: prices, Report: report}, nil
+}
+
+// Registry of Sources by name. Built-in upstreams are registered in init.
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Source{}
+)
+
+func init() {
+	for _, src := range []Source{ItemsSource{}, TransSource{}, MarketPricesSource{}, MafiaPricesSource{}} {
+		if err := Register(src); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register adds a Source to the registry. Names must be unique.
+func Register(src Source) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	name := src.Name()
+	if _, ok := registry[name]; ok {
+		return fmt.Errorf("error source %q already registered", name)
+	}
+	registry[name] = src
+	return nil
+}
+
+// Lookup returns the Source registered under name.
+func Lookup(name string) (Source, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	src, ok := registry[name]
+	return src, ok
+}
+
+// LookupKind returns the one registered Source of kind. False if there's none,
+// or more than one so the caller has to pick by name.
+func LookupKind(kind Kind) (Source, bool) {
+	var found Source
+	for _, src := range Sources() {
+		if src.Kind() != kind {
+			continue
+		}
+		if found != nil {
+			return nil, false
+		}
+		found = src
+	}
+	return found, found != nil
+}
+
+// Sources returns every registered Source sorted by name.
+func Sources() []Source {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	srcs := make([]Source, 0, len(registry))
+	for _, src := range registry {
+		srcs = append(srcs, src)
+	}
+	sort.Slice(srcs, func(i, j int) bool { return srcs[i].Name() < srcs[j].Name() })
+	return srcs
+}
@@ -0,0 +1,80 @@
+package data
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// MarketStreamTrans fetches the ColdFront transaction export at URL and calls fn
+// once per <trans> as it is decoded, so memory stays flat no matter how big the
+// window is. Returning an error from fn stops the stream and is returned as is.
+// The count of rows handed to fn is returned even on error.
+func MarketStreamTrans(ctx context.Context, URL string, fn func(structs.MarketTrans) error) (int, error) {
+	return DefaultClient.MarketStreamTrans(ctx, URL, fn)
+}
+
+// MarketStreamTrans using c's http.Client.
+func (c *Client) MarketStreamTrans(ctx context.Context, URL string, fn func(structs.MarketTrans) error) (int, error) {
+	// https://kol.coldfront.net/newmarket/export.php?start=1674968400&end=1674969465&itemid=
+	// Data is in XML format.
+	// Incoming data format: TransactionID: (ItemId Volume Cost Time)
+	respBody, err := c.getPayload(ctx, URL, acceptXML)
+	if err != nil {
+		return 0, fmt.Errorf("error getting URL: %w", err)
+	}
+	defer respBody.Close()
+
+	return streamTrans(respBody, fn)
+}
+
+// Walks the <marketplace> document token by token, only decoding one <trans> at a time.
+func streamTrans(r io.Reader, fn func(structs.MarketTrans) error) (int, error) {
+	decoder := xml.NewDecoder(r)
+	count := 0
+	sawRoot := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("error decoding xml: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		// Same check xml.Unmarshal into Market would do on the root element.
+		if !sawRoot {
+			if start.Name.Local != "marketplace" {
+				return count, fmt.Errorf("error decoding xml: expected <marketplace> but have <%s>", start.Name.Local)
+			}
+			sawRoot = true
+			continue
+		}
+		if start.Name.Local != "trans" {
+			continue
+		}
+
+		var trans Transactions
+		if err := decoder.DecodeElement(&trans, &start); err != nil {
+			return count, fmt.Errorf("error decoding trans: %w", err)
+		}
+		if err := fn(trans.toMarketTrans()); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	if !sawRoot {
+		return count, fmt.Errorf("error decoding xml: no <marketplace> element")
+	}
+	return count, nil
+}
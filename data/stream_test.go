@@ -0,0 +1,97 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+func TestStreamTrans(t *testing.T) {
+	two := `<?xml version="1.0"?>
+<marketplace>
+<trans id="11"><itemid>194</itemid><vol>2</vol><cost>150.5</cost><when>1700000000</when></trans>
+<other>ignored</other>
+<trans id="12"><itemid>895</itemid><vol>1</vol><cost>9</cost><when>1700000060</when></trans>
+</marketplace>`
+
+	tests := []struct {
+		name    string
+		body    string
+		want    []structs.MarketTrans
+		wantErr string
+	}{
+		{
+			name: "two trans",
+			body: two,
+			want: []structs.MarketTrans{
+				{TransID: 11, ItemID: 194, Volume: 2, Price: 150.5, Time: 1700000000},
+				{TransID: 12, ItemID: 895, Volume: 1, Price: 9, Time: 1700000060},
+			},
+		},
+		{
+			name: "no trans",
+			body: `<marketplace></marketplace>`,
+		},
+		{
+			name:    "empty body",
+			body:    "",
+			wantErr: "no <marketplace> element",
+		},
+		{
+			name:    "wrong root",
+			body:    `<html><trans id="1"></trans></html>`,
+			wantErr: "expected <marketplace> but have <html>",
+		},
+		{
+			name: "cut off",
+			body: `<marketplace><trans id="11"><itemid>194</itemid><vol>2</vol><cost>1</cost><when>1</when></trans><trans id="12"><itemid>8`,
+			want: []structs.MarketTrans{
+				{TransID: 11, ItemID: 194, Volume: 2, Price: 1, Time: 1},
+			},
+			wantErr: "error decoding trans",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []structs.MarketTrans
+			count, err := streamTrans(strings.NewReader(tt.body), func(trans structs.MarketTrans) error {
+				got = append(got, trans)
+				return nil
+			})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("streamTrans() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("streamTrans() error = %v, want one containing %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("streamTrans() rows = %v, want %v", got, tt.want)
+			}
+			if count != len(tt.want) {
+				t.Errorf("streamTrans() count = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestStreamTransStopsOnFnError(t *testing.T) {
+	stop := errors.New("stop")
+	body := `<marketplace>
+<trans id="1"><itemid>1</itemid><vol>1</vol><cost>1</cost><when>1</when></trans>
+<trans id="2"><itemid>1</itemid><vol>1</vol><cost>1</cost><when>1</when></trans>
+</marketplace>`
+	calls := 0
+	count, err := streamTrans(strings.NewReader(body), func(structs.MarketTrans) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("streamTrans() error = %v, want fn's error as is", err)
+	}
+	if calls != 1 || count != 0 {
+		t.Errorf("streamTrans() calls = %d, count = %d, want 1 and 0", calls, count)
+	}
+}
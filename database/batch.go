@@ -0,0 +1,203 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// DefaultBatchSize is rows per multi-row INSERT when BulkOptions doesn't say.
+const DefaultBatchSize = 500
+
+// Statement bytes a batch may use. Asked once per store.
+func (s *SQLStore) packetBudget(ctx context.Context) int {
+	s.budgetOnce.Do(func() {
+		s.budget = s.dialect.packetBudget(ctx, s.db)
+	})
+	return s.budget
+}
+
+// A name that isn't the item's current one also goes into item_history with
+// firstSeen seen, after the upsert so the foreign key is satisfied. item_history
+// has every name change, so its newest row is what item was called before the upsert.
+// Callers drop Mr. A's duplicates across the whole list first (itemsPerID) and
+// pass every batch the same seen, otherwise his two names could land in
+// different batches and be recorded as a rename on every refresh.
+func (s *SQLStore) insertItemsBatch(ctx context.Context, ex execer, items []structs.Items, seen time.Time) error {
+	if len(items) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(items)*2)
+	for _, item := range items {
+		args = append(args, item.ID, item.Name)
+	}
+
+	if _, err := ex.ExecContext(ctx, s.dialect.upsertItems(len(items)), args...); err != nil {
+		return fmt.Errorf("error func(insertItemsBatch) db.Exec() %w", err)
+	}
+
+	// UTC used for consistency, same as lastModified.
+	firstSeen := seen.UTC().Format(sqlTimeFormat)
+	args = make([]any, 0, len(items)*3)
+	for _, item := range items {
+		args = append(args, item.ID, item.Name, firstSeen)
+	}
+	if _, err := ex.ExecContext(ctx, s.dialect.insertItemHistory(len(items)), args...); err != nil {
+		return fmt.Errorf("error func(insertItemsBatch) history db.Exec() %w", err)
+	}
+	return nil
+}
+
+// No item_history row, that waits until the item list gives the item a name.
+func (s *SQLStore) insertUnnamedItemsBatch(ctx context.Context, ex execer, itemIDs []int) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+	itemIDs = lastPerKey(itemIDs, func(id int) int { return id })
+	args := make([]any, 0, len(itemIDs))
+	for _, id := range itemIDs {
+		args = append(args, id)
+	}
+
+	if _, err := ex.ExecContext(ctx, s.dialect.insertUnnamedItems(len(itemIDs)), args...); err != nil {
+		return fmt.Errorf("error func(insertUnnamedItemsBatch) db.Exec() %w", err)
+	}
+	return nil
+}
+
+// Rows whose itemID isn't in `item` are skipped. Every row also goes into
+// mafia_price_history, prices only keeps the last one per item.
+func (s *SQLStore) insertMafiaPricesBatch(ctx context.Context, ex execer, prices []structs.MafiaPrices) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	if _, err := ex.ExecContext(ctx, s.dialect.insertMafiaPriceHistory(len(prices)), mafiaPriceArgs(prices)...); err != nil {
+		return fmt.Errorf("error func(insertMafiaPricesBatch) history db.Exec() %w", err)
+	}
+
+	prices = lastPerKey(prices, func(price structs.MafiaPrices) int { return price.ItemID })
+	if _, err := ex.ExecContext(ctx, s.dialect.upsertMafiaPrices(len(prices)), mafiaPriceArgs(prices)...); err != nil {
+		return fmt.Errorf("error func(insertMafiaPricesBatch) db.Exec() %w", err)
+	}
+	return nil
+}
+
+func mafiaPriceArgs(prices []structs.MafiaPrices) []any {
+	args := make([]any, 0, len(prices)*3)
+	for _, price := range prices {
+		args = append(args, price.ItemID, price.Price, price.Time)
+	}
+	return args
+}
+
+// Rows whose itemID isn't in `item` are skipped. fetched is stored with every row.
+func (s *SQLStore) insertMarketPricesBatch(ctx context.Context, ex execer, prices []structs.MarketPrices, fetched time.Time) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	prices = lastPerKey(prices, func(price structs.MarketPrices) int { return price.ItemID })
+	// UTC used for consistency, same as lastModified.
+	fetchedAt := fetched.UTC().Format(sqlTimeFormat)
+	args := make([]any, 0, len(prices)*3)
+	for _, price := range prices {
+		args = append(args, price.ItemID, price.Price, fetchedAt)
+	}
+
+	if _, err := ex.ExecContext(ctx, s.dialect.upsertMarketPrices(len(prices)), args...); err != nil {
+		return fmt.Errorf("error func(insertMarketPricesBatch) db.Exec() %w", err)
+	}
+	return nil
+}
+
+// transIDs already stored are skipped.
+func (s *SQLStore) insertMarketTransBatch(ctx context.Context, ex execer, trans []structs.MarketTrans) error {
+	if len(trans) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(trans)*5)
+	for _, t := range trans {
+		args = append(args, t.TransID, t.ItemID, t.Volume, t.Price, t.Time)
+	}
+
+	if _, err := ex.ExecContext(ctx, s.dialect.insertMarketTrans(len(trans)), args...); err != nil {
+		return fmt.Errorf("error func(insertMarketTransBatch) db.Exec() %w", err)
+	}
+	return nil
+}
+
+// Drops all but the last row for each key, keeping order otherwise.
+// MySQL and SQLite upsert a repeated key row by row so the last one wins anyway
+// (Mr. A is in the item list twice), Postgres errors instead. This makes all three agree.
+func lastPerKey[T any, K comparable](rows []T, key func(T) K) []T {
+	kept := lastIndexes(rows, key)
+	if len(kept) == len(rows) {
+		return rows
+	}
+	last := make([]T, len(kept))
+	for i, index := range kept {
+		last[i] = rows[index]
+	}
+	return last
+}
+
+// Indexes of the rows lastPerKey keeps, ascending.
+func lastIndexes[T any, K comparable](rows []T, key func(T) K) []int {
+	last := make(map[K]int, len(rows))
+	for i, row := range rows {
+		last[key(row)] = i
+	}
+	kept := make([]int, 0, len(last))
+	for i, row := range rows {
+		if last[key(row)] == i {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+// Mr. A's last name only, for the whole item list.
+func itemsPerID(items []structs.Items) []structs.Items {
+	return lastPerKey(items, func(item structs.Items) int { return item.ID })
+}
+
+// Rough bytes each row adds to a batch statement, for staying under max_allowed_packet.
+
+// The item_history statement is the bigger one: "(?, ?, ?), " plus an int, the name and a DATETIME string.
+func itemBytes(item structs.Items) int { return 48 + len(item.Name) }
+
+// "(?), " plus an int.
+func unnamedItemBytes(int) int { return 16 }
+
+// " UNION ALL SELECT ?, ?, ?" plus three ints.
+func mafiaPriceBytes(structs.MafiaPrices) int { return 56 }
+
+// " UNION ALL SELECT ?, ?, ?" plus two ints and a DATETIME string.
+func marketPriceBytes(structs.MarketPrices) int { return 64 }
+
+// "(?, ?, ?, ?, ?), " plus five numbers.
+func marketTransBytes(structs.MarketTrans) int { return 64 }
+
+// Splits rows into [start, end) batches of at most size rows, at most
+// placeholders/cols rows, and at most budget estimated bytes.
+func planBatches[T any](rows []T, size int, cols int, placeholders int, budget int, rowBytes func(T) int) [][2]int {
+	if limit := placeholders / cols; size > limit {
+		size = limit
+	}
+
+	var batches [][2]int
+	start, bytes := 0, 0
+	for i, row := range rows {
+		n := rowBytes(row)
+		if i > start && (i-start >= size || bytes+n > budget) {
+			batches = append(batches, [2]int{start, i})
+			start, bytes = i, 0
+		}
+		bytes += n
+	}
+	if start < len(rows) {
+		batches = append(batches, [2]int{start, len(rows)})
+	}
+	return batches
+}
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanBatches(t *testing.T) {
+	rows := func(n int) []int { return make([]int, n) }
+	fixed := func(n int) func(int) int { return func(int) int { return n } }
+
+	tests := []struct {
+		name         string
+		rows         []int
+		size         int
+		cols         int
+		placeholders int
+		budget       int
+		rowBytes     func(int) int
+		want         [][2]int
+	}{
+		{
+			name: "no rows", rows: nil,
+			size: 10, cols: 2, placeholders: 100, budget: 1000, rowBytes: fixed(1),
+			want: nil,
+		},
+		{
+			name: "one batch", rows: rows(5),
+			size: 10, cols: 2, placeholders: 100, budget: 1000, rowBytes: fixed(1),
+			want: [][2]int{{0, 5}},
+		},
+		{
+			name: "exactly size", rows: rows(10),
+			size: 5, cols: 2, placeholders: 100, budget: 1000, rowBytes: fixed(1),
+			want: [][2]int{{0, 5}, {5, 10}},
+		},
+		{
+			name: "size with remainder", rows: rows(7),
+			size: 3, cols: 2, placeholders: 100, budget: 1000, rowBytes: fixed(1),
+			want: [][2]int{{0, 3}, {3, 6}, {6, 7}},
+		},
+		{
+			name: "placeholders win over size", rows: rows(7),
+			size: 100, cols: 5, placeholders: 15, budget: 1000, rowBytes: fixed(1),
+			want: [][2]int{{0, 3}, {3, 6}, {6, 7}},
+		},
+		{
+			name: "byte budget", rows: rows(5),
+			size: 100, cols: 2, placeholders: 100, budget: 25, rowBytes: fixed(10),
+			want: [][2]int{{0, 2}, {2, 4}, {4, 5}},
+		},
+		{
+			// A row bigger than the budget still gets a batch of its own instead of looping.
+			name: "row over budget", rows: rows(3),
+			size: 100, cols: 2, placeholders: 100, budget: 5, rowBytes: fixed(10),
+			want: [][2]int{{0, 1}, {1, 2}, {2, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := planBatches(tt.rows, tt.size, tt.cols, tt.placeholders, tt.budget, tt.rowBytes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLastPerKey(t *testing.T) {
+	type row struct {
+		key   int
+		value string
+	}
+	got := lastPerKey([]row{{1, "a"}, {2, "b"}, {1, "c"}, {3, "d"}}, func(r row) int { return r.key })
+	want := []row{{2, "b"}, {1, "c"}, {3, "d"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lastPerKey() = %v, want %v", got, want)
+	}
+}
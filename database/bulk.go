@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// DefaultWorkers is the bulk insert pool size. Capped at the store's open
+// connections so workers never sit waiting on one.
+const DefaultWorkers = 25
+
+// BulkOptions tunes a Store's Upsert/Insert methods. Zero values use the defaults.
+type BulkOptions struct {
+	// Statements running at once. <1 uses DefaultWorkers.
+	Workers int
+	// Rows per multi-row INSERT. <1 uses DefaultBatchSize, 1 is one row per statement.
+	// Batches are made smaller if they'd go over the packet size or the placeholder limit.
+	BatchSize int
+}
+
+// RowError is one row a bulk insert couldn't write.
+type RowError struct {
+	// Position in the slice that was passed in.
+	Index int
+	Row   any
+	Err   error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d %+v: %v", e.Index, e.Row, e.Err)
+}
+
+// BulkError is every failed row of one bulk insert, sorted by Index.
+type BulkError struct {
+	Table string
+	Total int
+	Rows  []RowError
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("error bulk insert %s: %d of %d row(s) failed, first %v", e.Table, len(e.Rows), e.Total, e.Rows[0])
+}
+
+// Unwrap gives the first row's error so errors.Is/As see something concrete.
+func (e *BulkError) Unwrap() error {
+	return e.Rows[0].Err
+}
+
+// UpsertItems writes items in multi-row batches on a bounded pool.
+// Every row is attempted. Failed rows come back in a *BulkError.
+// Only the last of a repeated itemID (Mr. A) is written, the earlier ones never fail.
+func (s *SQLStore) UpsertItems(ctx context.Context, items []structs.Items) error {
+	kept := lastIndexes(items, func(item structs.Items) int { return item.ID })
+	latest := itemsPerID(items)
+	seen := time.Now()
+	err := bulkInsert(ctx, latest, s.bulkPlan(ctx), writer[structs.Items]{
+		table:    "item",
+		cols:     3,
+		rowBytes: itemBytes,
+		insert: func(ctx context.Context, ex execer, rows []structs.Items) error {
+			return s.insertItemsBatch(ctx, ex, rows, seen)
+		},
+	})
+
+	// Point the failed rows back at items.
+	var bulkErr *BulkError
+	if errors.As(err, &bulkErr) {
+		bulkErr.Total = len(items)
+		for i := range bulkErr.Rows {
+			bulkErr.Rows[i].Index = kept[bulkErr.Rows[i].Index]
+		}
+	}
+	return err
+}
+
+// UpsertMafiaPrices writes prices in batches. See UpsertItems.
+func (s *SQLStore) UpsertMafiaPrices(ctx context.Context, prices []structs.MafiaPrices) error {
+	return bulkInsert(ctx, prices, s.bulkPlan(ctx), writer[structs.MafiaPrices]{
+		table:    "prices",
+		cols:     3,
+		rowBytes: mafiaPriceBytes,
+		insert:   s.insertMafiaPricesBatch,
+	})
+}
+
+// UpsertMarketPrices writes ColdFront prices fetched at fetched in batches. See UpsertItems.
+func (s *SQLStore) UpsertMarketPrices(ctx context.Context, prices []structs.MarketPrices, fetched time.Time) error {
+	return bulkInsert(ctx, prices, s.bulkPlan(ctx), writer[structs.MarketPrices]{
+		table:    "market_prices",
+		cols:     3,
+		rowBytes: marketPriceBytes,
+		insert: func(ctx context.Context, ex execer, rows []structs.MarketPrices) error {
+			return s.insertMarketPricesBatch(ctx, ex, rows, fetched)
+		},
+	})
+}
+
+// InsertMarketTrans writes trans in batches. See UpsertItems.
+func (s *SQLStore) InsertMarketTrans(ctx context.Context, trans []structs.MarketTrans) error {
+	return bulkInsert(ctx, trans, s.bulkPlan(ctx), writer[structs.MarketTrans]{
+		table:    "transactions",
+		cols:     5,
+		rowBytes: marketTransBytes,
+		insert:   s.insertMarketTransBatch,
+	})
+}
+
+// The store's BulkOptions plus what bulkInsert needs to know about the backend.
+func (s *SQLStore) bulkPlan(ctx context.Context) bulkPlan {
+	return bulkPlan{
+		BulkOptions:  s.bulk,
+		placeholders: s.dialect.maxPlaceholders(),
+		budget:       s.packetBudget(ctx),
+		ex:           s.db,
+	}
+}
+
+type bulkPlan struct {
+	BulkOptions
+	placeholders int
+	budget       int
+	ex           execer
+}
+
+// How to write one table's rows, in batches and one at a time.
+// A batch of one is the single row insert.
+type writer[T any] struct {
+	table    string
+	cols     int
+	rowBytes func(T) int
+	insert   func(context.Context, execer, []T) error
+}
+
+// Feeds batches of rows to a bounded pool and collects every failed row.
+// A failed batch is redone row by row so the error lands on the rows that caused it.
+// A cancelled ctx stops handing out batches and is returned instead.
+func bulkInsert[T any](ctx context.Context, rows []T, opts bulkPlan, w writer[T]) error {
+	if opts.Workers < 1 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	var batches [][2]int
+	if opts.BatchSize == 1 {
+		for i := range rows {
+			batches = append(batches, [2]int{i, i + 1})
+		}
+	} else {
+		batches = planBatches(rows, opts.BatchSize, w.cols, opts.placeholders, opts.budget, w.rowBytes)
+	}
+
+	work := make(chan [2]int)
+	var mu sync.Mutex
+	var rowErrs []RowError
+	fail := func(i int, err error) {
+		mu.Lock()
+		rowErrs = append(rowErrs, RowError{Index: i, Row: rows[i], Err: err})
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for n := 0; n < opts.Workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for span := range work {
+				err := w.insert(ctx, opts.ex, rows[span[0]:span[1]])
+				if err == nil {
+					continue
+				}
+				if span[1]-span[0] == 1 || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+					fail(span[0], err)
+					continue
+				}
+				for i := span[0]; i < span[1]; i++ {
+					if err := w.insert(ctx, opts.ex, rows[i:i+1]); err != nil {
+						fail(i, err)
+					}
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, span := range batches {
+		select {
+		case work <- span:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error bulk insert %s cancelled: %w", w.table, err)
+	}
+	if len(rowErrs) > 0 {
+		sort.Slice(rowErrs, func(i, j int) bool { return rowErrs[i].Index < rowErrs[j].Index })
+		return &BulkError{Table: w.table, Total: len(rows), Rows: rowErrs}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+func TestBulkInsertReportsFailedRows(t *testing.T) {
+	bad := errors.New("bad row")
+	rows := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	var mu sync.Mutex
+	written := map[int]bool{}
+	w := writer[int]{
+		table:    "test",
+		cols:     1,
+		rowBytes: func(int) int { return 1 },
+		// Like a statement, a batch with a bad row writes none of it.
+		insert: func(ctx context.Context, ex execer, batch []int) error {
+			for _, row := range batch {
+				if row == 3 || row == 7 {
+					return bad
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, row := range batch {
+				written[row] = true
+			}
+			return nil
+		},
+	}
+
+	plan := bulkPlan{BulkOptions: BulkOptions{Workers: 2, BatchSize: 4}, placeholders: 100, budget: 100}
+	err := bulkInsert(context.Background(), rows, plan, w)
+	var bulkErr *BulkError
+	if !errors.As(err, &bulkErr) {
+		t.Fatalf("bulkInsert() error = %v, want a *BulkError", err)
+	}
+	var failed []int
+	for _, rowErr := range bulkErr.Rows {
+		failed = append(failed, rowErr.Index)
+		if rowErr.Row != rows[rowErr.Index] || !errors.Is(rowErr.Err, bad) {
+			t.Errorf("RowError = %+v, want row %d failing with %v", rowErr, rows[rowErr.Index], bad)
+		}
+	}
+	if want := []int{3, 7}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("BulkError rows = %v, want %v", failed, want)
+	}
+	if bulkErr.Table != "test" || bulkErr.Total != len(rows) || !errors.Is(err, bad) {
+		t.Errorf("BulkError = %v, want table test, total %d, unwrapping to %v", bulkErr, len(rows), bad)
+	}
+	// The good rows in the failed batches still go in.
+	if len(written) != 8 {
+		t.Errorf("bulkInsert() wrote %v, want every row but 3 and 7", written)
+	}
+}
+
+func TestInsertMarketTransBulkError(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		if err := store.UpsertItems(ctx, []structs.Items{{ID: 1, Name: "known"}}); err != nil {
+			t.Fatal(err)
+		}
+		trans := []structs.MarketTrans{
+			{TransID: 1, ItemID: 1, Volume: 1, Price: 1, Time: 1},
+			{TransID: 2, ItemID: 2, Volume: 1, Price: 1, Time: 1},
+			{TransID: 3, ItemID: 1, Volume: 1, Price: 1, Time: 1},
+		}
+		err := store.InsertMarketTrans(ctx, trans)
+		var bulkErr *BulkError
+		if !errors.As(err, &bulkErr) {
+			t.Fatalf("InsertMarketTrans() error = %v, want a *BulkError", err)
+		}
+		if len(bulkErr.Rows) != 1 || bulkErr.Rows[0].Index != 1 || bulkErr.Rows[0].Row != trans[1] {
+			t.Errorf("BulkError rows = %v, want just row 1", bulkErr.Rows)
+		}
+	})
+}
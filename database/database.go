@@ -1,189 +1,278 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/abramtrinh/koldb/structs"
 	"github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
 )
 
-// Global unexported db connector
-var db *sql.DB
+// Drivers Open knows about.
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
 
-// Sets up the db connector pool
-func DBConnectInit() error {
-	// db.env should be in root aka ./koldb
-	err := godotenv.Load("db.env")
-	if err != nil {
-		return fmt.Errorf("error loading env %w\n", err)
+// Store is everything koldb needs from a database. Open picks the backend.
+type Store interface {
+	// UpsertItems inserts items, renaming any that already exist.
+	// Every name is also kept in the item history.
+	UpsertItems(ctx context.Context, items []structs.Items) error
+	// UpsertMafiaPrices sets each item's current kolmafia price and adds every
+	// price to the history. Prices for items not in the item table are skipped.
+	UpsertMafiaPrices(ctx context.Context, prices []structs.MafiaPrices) error
+	// MafiaPriceHistory is itemID's kolmafia prices between from and to, oldest first.
+	// Zero from or to leaves that end open.
+	MafiaPriceHistory(ctx context.Context, itemID int, from time.Time, to time.Time) ([]structs.MafiaPrices, error)
+	// MafiaPriceAt is itemID's kolmafia price as of at. Wraps sql.ErrNoRows if there isn't one.
+	MafiaPriceAt(ctx context.Context, itemID int, at time.Time) (structs.MafiaPrices, error)
+	// UpsertMarketPrices sets each item's ColdFront latest price, fetched at fetched.
+	// Prices for items not in the item table are skipped.
+	UpsertMarketPrices(ctx context.Context, prices []structs.MarketPrices, fetched time.Time) error
+	// InsertMarketTrans adds transactions, skipping transIDs already stored.
+	InsertMarketTrans(ctx context.Context, trans []structs.MarketTrans) error
+
+	// ItemIDs is every itemID in the item table, ascending.
+	ItemIDs(ctx context.Context) ([]int, error)
+	// ItemHistory is every name itemID has had, oldest first.
+	ItemHistory(ctx context.Context, itemID int) ([]ItemName, error)
+	// ResolveItemName is every item that is or was called name.
+	ResolveItemName(ctx context.Context, name string) ([]ItemName, error)
+
+	// LastModified is the newest time in tableName ("dbUpdate" or "gameDataUpdate").
+	// For dbUpdate that's LastRun(SyncSource), Sync's watermark.
+	// Wraps sql.ErrNoRows if nothing has been recorded yet.
+	LastModified(ctx context.Context, tableName string) (time.Time, error)
+	// SetLastModified records modified in tableName. For dbUpdate it's a SyncSource run.
+	SetLastModified(ctx context.Context, tableName string, modified time.Time) error
+	// RecordRun adds a fetch run to dbUpdate, failed or not.
+	RecordRun(ctx context.Context, run RunRecord) error
+	// LastRun is source's newest run that worked. Wraps sql.ErrNoRows if there isn't one.
+	LastRun(ctx context.Context, source string) (RunRecord, error)
+
+	// Ingest writes run all or nothing. See Run.
+	Ingest(ctx context.Context, run Run) error
+
+	MigrateUp(ctx context.Context) (int, error)
+	MigrateDown(ctx context.Context, steps int) (int, error)
+	MigrationStatuses(ctx context.Context) ([]MigrationStatus, error)
+
+	Close() error
+}
+
+// Config picks and tunes a Store.
+type Config struct {
+	// DriverMySQL, DriverPostgres or DriverSQLite.
+	Driver string
+	// Driver specific. MySQL is a go-sql-driver DSN, Postgres a lib/pq URL or
+	// key=value string, SQLite a file path.
+	DSN string
+	// 0 uses the driver's default (DefaultWorkers for MySQL and Postgres, 1 for SQLite).
+	MaxOpenConns int
+	// Used by the Upsert/Insert methods.
+	Bulk BulkOptions
+}
+
+// DSNFromEnv is driver's DSN from the db.env style env vars. MySQL is built
+// from DBUSER, DBPASS, NET, ADDRESS and DBNAME, Postgres reads POSTGRES_DSN,
+// SQLite reads SQLITE_PATH (default koldb.db).
+func DSNFromEnv(driver string) string {
+	switch driver {
+	case DriverMySQL:
+		// Capture connection properties.
+		mysqlCfg := mysql.Config{
+			User:   os.Getenv("DBUSER"),
+			Passwd: os.Getenv("DBPASS"),
+			Net:    os.Getenv("NET"),
+			Addr:   os.Getenv("ADDRESS"),
+			DBName: os.Getenv("DBNAME"),
+		}
+		return mysqlCfg.FormatDSN()
+	case DriverPostgres:
+		return os.Getenv("POSTGRES_DSN")
+	case DriverSQLite:
+		if path := os.Getenv("SQLITE_PATH"); path != "" {
+			return path
+		}
+		return "koldb.db"
 	}
+	return ""
+}
 
-	// Capture connection properties.
-	cfg := mysql.Config{
-		User:   os.Getenv("DBUSER"),
-		Passwd: os.Getenv("DBPASS"),
-		Net:    os.Getenv("NET"),
-		Addr:   os.Getenv("ADDRESS"),
-		DBName: os.Getenv("DBNAME"),
+// Open connects to the database cfg describes and pings it.
+func Open(ctx context.Context, cfg Config) (Store, error) {
+	var d dialect
+	switch cfg.Driver {
+	case DriverMySQL:
+		d = mysqlDialect{}
+	case DriverPostgres:
+		d = postgresDialect{}
+	case DriverSQLite:
+		d = sqliteDialect{}
+	default:
+		return nil, fmt.Errorf("error unknown database driver %q", cfg.Driver)
 	}
 
 	// Get a database handle.
-	db, err = sql.Open("mysql", cfg.FormatDSN())
+	db, err := sql.Open(d.driverName(), d.dsn(cfg.DSN))
 	if err != nil {
-		return fmt.Errorf("error failed opening db %w", err)
+		return nil, fmt.Errorf("error failed opening db %w", err)
 	}
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
-		return fmt.Errorf("error failed ping db %w", err)
+		db.Close()
+		return nil, fmt.Errorf("error failed ping db %w", err)
 	}
-	fmt.Println("Connected!")
+
 	// Set so I can use goroutines without hitting the "Too many connections" error
-	db.SetMaxOpenConns(25)
-	return nil
-}
+	conns := cfg.MaxOpenConns
+	if conns < 1 {
+		conns = d.maxOpenConns()
+	}
+	db.SetMaxOpenConns(conns)
 
-// Function (used with goroutines) init populates item table.
-func InsertItems(wg *sync.WaitGroup, itemID int, itemName string) error {
-	// wg.Done() is used because I'm using goroutines and want to finish all runs first.
-	defer wg.Done()
+	// No point running more workers than there are connections.
+	if cfg.Bulk.Workers < 1 || cfg.Bulk.Workers > conns {
+		cfg.Bulk.Workers = conns
+	}
 
-	// Using REPLACE over INSERT because Mr. A has 1 old 1 new value.
-	// REPLACE deletes old entries which causes other tables to cascade. So...
-	// Instead now using INSERT ... ON DUPLICATE KEY UPDATE so above doesn't occur.
-	stmt := `
-	INSERT INTO item (itemID, itemName) 
-	VALUES (?, ?) 
-	ON DUPLICATE KEY UPDATE itemName=?`
+	return &SQLStore{db: db, dialect: d, bulk: cfg.Bulk}, nil
+}
 
-	_, err := db.Exec(stmt, itemID, itemName, itemName)
-	if err != nil {
-		//temp need to remove either goroutines or use channels to return errors
-		fmt.Printf("error InsertItems %v\n", err)
-		// Should I fatal/exit if this fails? Don't want to continue if bad insert. tx?
-		return fmt.Errorf("error func(insertItems) db.Exec() %w\n", err)
-	}
-	return nil
+// SQLStore is a Store on top of database/sql. The dialect supplies the SQL.
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+	bulk    BulkOptions
+
+	budgetOnce sync.Once
+	budget     int
 }
 
-// Function (used with goroutines) init populates prices table.
-func InsertMafiaPrices(wg *sync.WaitGroup, itemID int, cost int, epochTime int64) error {
-	defer wg.Done()
+// execer is what *sql.DB and *sql.Tx have in common, so the same insert code
+// runs inside or outside a transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
 
-	// INSERT ... ON DUPLICATE KEY UPUDATE is good here because update prices regularly.
-	// Inserts itemID:cost:epochTime into `prices` if itemID is present in `item`. If already exists in `prices`, just updates it.
-	stmt := `
-	INSERT INTO prices (itemID, cost, epochTime)
-	SELECT item.itemID, ?, ? 
-	FROM item 
-	WHERE item.itemID=? 
-	ON DUPLICATE KEY UPDATE prices.cost=?, prices.epochTime=?`
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
 
-	_, err := db.Exec(stmt, cost, epochTime, itemID, cost, epochTime)
-	if err != nil {
-		//temp need to remove either goroutines or use channels to return errors
-		fmt.Printf("error InsertMafiaPrices %v\n", err)
-		return fmt.Errorf("error func(insertMafiaPrices) db.Exec() %w\n", err)
+// Switch statement is used so I can "parameterize" the sql table name without
+// passing user input into the query.
+func timestampTable(tableName string) (string, error) {
+	switch tableName {
+	case "gameDataUpdate", "dbUpdate":
+		return tableName, nil
+	default:
+		return "", fmt.Errorf("error wrong tableName: %s", tableName)
 	}
-	return nil
 }
 
-// Function (used with goroutines) init populates transactions table.
-func InsertMarketTrans(wg *sync.WaitGroup, transID int, itemID int, volume int, cost float32, epochTime int64) error {
-	defer wg.Done()
+// This is the same format as MySQL DATETIME type.
+const sqlTimeFormat = "2006-01-02 15:04:05"
 
-	// INSERT ... ON DUPLICATE KEY UPDATE is used instead of INSERT IGNORE because latter supresses errors.
-	// transID=transID is used for the UPDATE because MySQL doesn't actually do the update.
-	stmt := `
-	INSERT INTO transactions (transID, itemID, volume, cost, epochTime) 
-	VALUES (?, ?, ?, ?, ?) 
-	ON DUPLICATE KEY UPDATE transID=transID`
+func (s *SQLStore) SetLastModified(ctx context.Context, tableName string, modified time.Time) error {
+	return s.setLastModified(ctx, s.db, tableName, modified)
+}
 
-	_, err := db.Exec(stmt, transID, itemID, volume, cost, epochTime)
+func (s *SQLStore) setLastModified(ctx context.Context, ex execer, tableName string, modified time.Time) error {
+	table, err := timestampTable(tableName)
 	if err != nil {
-		//temp need to remove either goroutines or use channels to return errors
-		fmt.Printf("error InsertMarketTrans %v\n", err)
-		return fmt.Errorf("error func(insertMarketTrans) db.Exec() %w\n", err)
+		return fmt.Errorf("error SetLastModified %w", err)
 	}
-	return nil
-}
-
-func InsertCurrTime(tableName string) error {
-	var stmt string
-
-	// Switch statement is used so I can "parameterize" the sql table name without string conc.
-	switch tableName {
-	case "gameDataUpdate":
-		fmt.Println("gameDataUpdate")
-		stmt = `
-		INSERT INTO gameDataUpdate (lastModified)
-		VALUES (?)
-		`
-	case "dbUpdate":
-		fmt.Println("dbUpdate")
-		stmt = `
-		INSERT INTO dbUpdate (lastModified)
-		VALUES (?)
-		`
-	default:
-		return fmt.Errorf("error InsertCurrTime wrong tableName: %s\n", tableName)
+	if table == "dbUpdate" {
+		return s.recordRun(ctx, ex, RunRecord{Source: SyncSource, Finished: modified})
 	}
 
 	// UTC used for consistency. Remember to convert.
-	currTime := time.Now().UTC()
-	// This is the same format as MySQL DATETIME type.
-	formatTime := currTime.Format("2006-01-02 15:04:05")
+	formatTime := modified.UTC().Format(sqlTimeFormat)
 
-	_, err := db.Exec(stmt, formatTime)
+	_, err = ex.ExecContext(ctx, s.dialect.insertModified(table), formatTime)
 	if err != nil {
-		return fmt.Errorf("error InsertCurrTime db.Exec() %w\n", err)
+		return fmt.Errorf("error SetLastModified db.Exec() %w", err)
 	}
-
 	return nil
 }
 
-func GetLastModifiedTime(tableName string) (time.Time, error) {
-	var stmt string
-
-	switch tableName {
-	case "gameDataUpdate":
-		fmt.Println("gameDataUpdate")
-		stmt = `
-		SELECT * FROM gameDataUpdate
-		ORDER BY lastModified DESC
-		LIMIT 1
-		`
-	case "dbUpdate":
-		fmt.Println("dbUpdate")
-		stmt = `
-		SELECT * FROM dbUpdate
-		ORDER BY lastModified DESC
-		LIMIT 1
-		`
-	default:
+func (s *SQLStore) LastModified(ctx context.Context, tableName string) (time.Time, error) {
+	table, err := timestampTable(tableName)
+	if err != nil {
 		// time.Time{} is Go's zero date.
-		return time.Time{}, fmt.Errorf("error GetLastModifiedTime wrong tableName: %s\n", tableName)
+		return time.Time{}, fmt.Errorf("error LastModified %w", err)
+	}
+	if table == "dbUpdate" {
+		run, err := s.LastRun(ctx, SyncSource)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error LastModified %w", err)
+		}
+		return run.Finished, nil
 	}
 
-	// MySQL returns DATETIME type as string
-	var sqlTime string
-	row := db.QueryRow(stmt)
+	var sqlTime any
+	row := s.db.QueryRowContext(ctx, s.dialect.lastModified(table))
 	if err := row.Scan(&sqlTime); err != nil {
 		if err == sql.ErrNoRows {
-			return time.Time{}, fmt.Errorf("error GetLastModifiedTime no rows: %w\n", err)
+			return time.Time{}, fmt.Errorf("error LastModified no rows: %w", err)
 		}
-		return time.Time{}, fmt.Errorf("error GetLastModifiedTime scan: %w\n", err)
+		return time.Time{}, fmt.Errorf("error LastModified scan: %w", err)
 	}
 
-	// timeModified is changed to time.Time type and has default of UTC
-	timeModified, err := time.Parse("2006-01-02 15:04:05", sqlTime)
+	timeModified, err := scanTime(sqlTime)
 	if err != nil {
-		return time.Time{}, fmt.Errorf("error GetLastModifiedTime parse time: %w\n", err)
+		return time.Time{}, fmt.Errorf("error LastModified %w", err)
 	}
-
 	return timeModified, nil
 }
+
+// MySQL returns DATETIME type as string, the SQLite and Postgres drivers as time.Time.
+// Either way the result is UTC.
+func scanTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC(), nil
+	case []byte:
+		return scanTime(string(t))
+	case string:
+		// timeModified is changed to time.Time type and has default of UTC
+		parsed, err := time.Parse(sqlTimeFormat, t)
+		if err != nil {
+			parsed, err = time.Parse(time.RFC3339Nano, t)
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parse time %q: %w", t, err)
+		}
+		return parsed.UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("error parse time: unexpected type %T", v)
+	}
+}
+
+func (s *SQLStore) ItemIDs(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT itemID FROM item ORDER BY itemID`)
+	if err != nil {
+		return nil, fmt.Errorf("error ItemIDs query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error ItemIDs scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error ItemIDs rows: %w", err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// dialect is the per backend SQL. Every statement takes its args in the same
+// order regardless of backend, so SQLStore doesn't care which one it has.
+type dialect interface {
+	// Also the migrations/<name> directory.
+	name() string
+	driverName() string
+	// Turns a statement written with ? placeholders into the driver's own.
+	bind(query string) string
+	// Adds whatever connection options koldb relies on.
+	dsn(dsn string) string
+	maxOpenConns() int
+	maxPlaceholders() int
+	// Statement bytes one batch may use.
+	packetBudget(ctx context.Context, db *sql.DB) int
+
+	// Args per row: itemID, itemName.
+	upsertItems(rows int) string
+	// Args per row: itemID. Adds items with a NULL itemName, leaves ones already there alone.
+	insertUnnamedItems(rows int) string
+	// Args per row: itemID, itemName, firstSeen. Only adds a row when the name
+	// isn't the item's newest one in the history, a second change in the same
+	// second replaces the first.
+	insertItemHistory(rows int) string
+	// Args per row: itemID, cost, epochTime.
+	upsertMafiaPrices(rows int) string
+	// Same args as upsertMafiaPrices. Keeps rows already in the history.
+	insertMafiaPriceHistory(rows int) string
+	// Args per row: itemID, cost, fetchedAt.
+	upsertMarketPrices(rows int) string
+	// Args per row: transID, itemID, volume, cost, epochTime.
+	insertMarketTrans(rows int) string
+
+	// table is already checked by timestampTable.
+	insertModified(table string) string
+	lastModified(table string) string
+	// Args: source, lastModified, rowCount, runError. A second run in the same second replaces the first.
+	insertRun() string
+	// Arg: source. Newest run without a runError.
+	lastRun() string
+
+	// Whether a migration and its schema_migrations row can go in one transaction.
+	transactionalDDL() bool
+	createMigrationsTable() string
+	insertMigration() string
+	deleteMigration() string
+}
+
+// Returns "(?, ?), (?, ?)" for rows rows of cols columns.
+func valuesList(rows int, cols int) string {
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", cols), ", ") + ")"
+	return strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+// MySQL before 8.0.19 can't SELECT from VALUES, so derived table rows are a
+// UNION ALL of SELECTs with the column names on the first.
+func unionSelects(rows int, cols ...string) string {
+	first := make([]string, len(cols))
+	for i, col := range cols {
+		first[i] = "? AS " + col
+	}
+	rest := strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ")
+
+	selects := make([]string, rows)
+	for i := range selects {
+		if i == 0 {
+			selects[i] = "SELECT " + strings.Join(first, ", ")
+		} else {
+			selects[i] = "SELECT " + rest
+		}
+	}
+	return strings.Join(selects, " UNION ALL ")
+}
+
+type mysqlDialect struct{}
+
+// Used if @@max_allowed_packet can't be read. The MySQL 5.7 default, 8.0 is bigger.
+const fallbackMaxPacket = 4 << 20
+
+func (mysqlDialect) name() string             { return DriverMySQL }
+func (mysqlDialect) driverName() string       { return "mysql" }
+func (mysqlDialect) dsn(dsn string) string    { return dsn }
+func (mysqlDialect) bind(query string) string { return query }
+
+// Same as DefaultWorkers so workers never sit waiting on a connection.
+func (mysqlDialect) maxOpenConns() int { return DefaultWorkers }
+
+// MySQL prepared statements can't have more placeholders than this.
+func (mysqlDialect) maxPlaceholders() int { return 65535 }
+
+// MySQL commits every CREATE/ALTER/DROP on its own.
+func (mysqlDialect) transactionalDDL() bool { return false }
+
+// Half of max_allowed_packet leaves room for the protocol overhead on top of
+// our rough per row estimates.
+func (mysqlDialect) packetBudget(ctx context.Context, db *sql.DB) int {
+	size := fallbackMaxPacket
+	var serverSize int
+	if err := db.QueryRowContext(ctx, `SELECT @@max_allowed_packet`).Scan(&serverSize); err == nil && serverSize > 0 {
+		size = serverSize
+	}
+	return size / 2
+}
+
+func (mysqlDialect) upsertItems(rows int) string {
+	// Using REPLACE over INSERT because Mr. A has 1 old 1 new value.
+	// REPLACE deletes old entries which causes other tables to cascade. So...
+	// Instead now using INSERT ... ON DUPLICATE KEY UPDATE so above doesn't occur.
+	// VALUES() is the pre 8.0.19 way of saying "the value this row tried to insert". Still works.
+	return `
+	INSERT INTO item (itemID, itemName)
+	VALUES ` + valuesList(rows, 2) + `
+	ON DUPLICATE KEY UPDATE itemName=VALUES(itemName)`
+}
+
+func (mysqlDialect) insertItemHistory(rows int) string {
+	// <=> is MySQL's null safe =, a new item has no newest name.
+	return `
+	INSERT INTO item_history (itemID, itemName, firstSeen)
+	SELECT v.itemID, v.itemName, v.firstSeen
+	FROM (` + unionSelects(rows, "itemID", "itemName", "firstSeen") + `) AS v
+	WHERE NOT v.itemName <=> (
+		SELECT h.itemName FROM item_history h WHERE h.itemID = v.itemID
+		ORDER BY h.firstSeen DESC LIMIT 1)
+	ON DUPLICATE KEY UPDATE itemName=v.itemName`
+}
+
+// itemID=itemID leaves an existing item and its name alone, same as insertMarketTrans.
+func (mysqlDialect) insertUnnamedItems(rows int) string {
+	return `
+	INSERT INTO item (itemID)
+	VALUES ` + valuesList(rows, 1) + `
+	ON DUPLICATE KEY UPDATE itemID=itemID`
+}
+
+func (mysqlDialect) upsertMafiaPrices(rows int) string {
+	// INSERT ... ON DUPLICATE KEY UPUDATE is good here because update prices regularly.
+	// The rows are built as a derived table so the JOIN only inserts prices for
+	// items present in `item`. If already exists in `prices`, just updates it.
+	return `
+	INSERT INTO prices (itemID, cost, epochTime)
+	SELECT item.itemID, v.cost, v.epochTime
+	FROM (` + unionSelects(rows, "itemID", "cost", "epochTime") + `) AS v
+	JOIN item ON item.itemID = v.itemID
+	ON DUPLICATE KEY UPDATE prices.cost=v.cost, prices.epochTime=v.epochTime`
+}
+
+// Same derived table as upsertMafiaPrices. itemID=itemID leaves an existing row alone.
+func (mysqlDialect) insertMafiaPriceHistory(rows int) string {
+	return `
+	INSERT INTO mafia_price_history (itemID, cost, epochTime)
+	SELECT item.itemID, v.cost, v.epochTime
+	FROM (` + unionSelects(rows, "itemID", "cost", "epochTime") + `) AS v
+	JOIN item ON item.itemID = v.itemID
+	ON DUPLICATE KEY UPDATE mafia_price_history.itemID=mafia_price_history.itemID`
+}
+
+// Same as upsertMafiaPrices, unknown items are skipped.
+func (mysqlDialect) upsertMarketPrices(rows int) string {
+	return `
+	INSERT INTO market_prices (itemID, cost, fetchedAt)
+	SELECT item.itemID, v.cost, v.fetchedAt
+	FROM (` + unionSelects(rows, "itemID", "cost", "fetchedAt") + `) AS v
+	JOIN item ON item.itemID = v.itemID
+	ON DUPLICATE KEY UPDATE market_prices.cost=v.cost, market_prices.fetchedAt=v.fetchedAt`
+}
+
+func (mysqlDialect) insertMarketTrans(rows int) string {
+	// INSERT ... ON DUPLICATE KEY UPDATE is used instead of INSERT IGNORE because latter supresses errors.
+	// transID=transID is used for the UPDATE because MySQL doesn't actually do the update.
+	return `
+	INSERT INTO transactions (transID, itemID, volume, cost, epochTime)
+	VALUES ` + valuesList(rows, 5) + `
+	ON DUPLICATE KEY UPDATE transID=transID`
+}
+
+func (mysqlDialect) insertModified(table string) string {
+	return fmt.Sprintf(`INSERT INTO %s (lastModified) VALUES (?)`, table)
+}
+
+func (mysqlDialect) lastModified(table string) string {
+	return fmt.Sprintf(`SELECT lastModified FROM %s ORDER BY lastModified DESC LIMIT 1`, table)
+}
+
+func (mysqlDialect) insertRun() string {
+	return `
+	INSERT INTO dbUpdate (source, lastModified, rowCount, runError)
+	VALUES (?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE rowCount = VALUES(rowCount), runError = VALUES(runError)`
+}
+
+func (mysqlDialect) lastRun() string {
+	return `
+	SELECT lastModified, rowCount FROM dbUpdate
+	WHERE source = ? AND runError IS NULL
+	ORDER BY lastModified DESC LIMIT 1`
+}
+
+func (mysqlDialect) createMigrationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		appliedAt DATETIME NOT NULL,
+		CONSTRAINT schema_migrations_pk PRIMARY KEY(version)
+	)`
+}
+
+func (mysqlDialect) insertMigration() string {
+	return `INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)`
+}
+
+func (mysqlDialect) deleteMigration() string {
+	return `DELETE FROM schema_migrations WHERE version=?`
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// Zero from/to mean no bound. epochTime is unix seconds in an INT column, so
+// the open end is MaxInt32 (Postgres rejects anything bigger for an integer param).
+func epochRange(from time.Time, to time.Time) (int64, int64) {
+	start, end := int64(0), int64(math.MaxInt32)
+	if !from.IsZero() {
+		start = from.Unix()
+	}
+	if !to.IsZero() {
+		end = to.Unix()
+	}
+	return start, end
+}
+
+// MafiaPriceHistory is itemID's kolmafia prices between from and to (inclusive), oldest first.
+// A zero from or to leaves that end open.
+func (s *SQLStore) MafiaPriceHistory(ctx context.Context, itemID int, from time.Time, to time.Time) ([]structs.MafiaPrices, error) {
+	start, end := epochRange(from, to)
+	stmt := s.dialect.bind(`
+	SELECT itemID, cost, epochTime FROM mafia_price_history
+	WHERE itemID=? AND epochTime>=? AND epochTime<=?
+	ORDER BY epochTime`)
+
+	rows, err := s.db.QueryContext(ctx, stmt, itemID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("error MafiaPriceHistory query: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []structs.MafiaPrices
+	for rows.Next() {
+		var price structs.MafiaPrices
+		if err := rows.Scan(&price.ItemID, &price.Price, &price.Time); err != nil {
+			return nil, fmt.Errorf("error MafiaPriceHistory scan: %w", err)
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error MafiaPriceHistory rows: %w", err)
+	}
+	return prices, nil
+}
+
+// MafiaPriceAt is itemID's kolmafia price as of at, the newest one no later than it.
+// Wraps sql.ErrNoRows if there's none that old.
+func (s *SQLStore) MafiaPriceAt(ctx context.Context, itemID int, at time.Time) (structs.MafiaPrices, error) {
+	stmt := s.dialect.bind(`
+	SELECT itemID, cost, epochTime FROM mafia_price_history
+	WHERE itemID=? AND epochTime<=?
+	ORDER BY epochTime DESC LIMIT 1`)
+
+	var price structs.MafiaPrices
+	err := s.db.QueryRowContext(ctx, stmt, itemID, at.Unix()).Scan(&price.ItemID, &price.Price, &price.Time)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return structs.MafiaPrices{}, fmt.Errorf("error MafiaPriceAt no rows: %w", err)
+		}
+		return structs.MafiaPrices{}, fmt.Errorf("error MafiaPriceAt scan: %w", err)
+	}
+	return price, nil
+}
+
+// ItemName is one name an item has had.
+type ItemName struct {
+	ItemID int
+	Name   string
+	// When koldb first saw the item under Name, UTC.
+	FirstSeen time.Time
+	// This is the item's newest name, what it is called now. An A→B→A item
+	// has two A rows and only the second is current.
+	Current bool
+}
+
+// ItemHistory is every name itemID has had, oldest first.
+func (s *SQLStore) ItemHistory(ctx context.Context, itemID int) ([]ItemName, error) {
+	stmt := s.dialect.bind(`
+	SELECT item_history.itemID, item_history.itemName, item_history.firstSeen,
+		(SELECT MAX(newest.firstSeen) FROM item_history newest WHERE newest.itemID = item_history.itemID)
+	FROM item_history
+	WHERE item_history.itemID=?
+	ORDER BY item_history.firstSeen, item_history.itemName`)
+	return s.queryItemNames(ctx, "ItemHistory", stmt, itemID)
+}
+
+// ResolveItemName finds every item that is or was called name, so old reports
+// still get the right itemID. More than one item can share a name.
+func (s *SQLStore) ResolveItemName(ctx context.Context, name string) ([]ItemName, error) {
+	stmt := s.dialect.bind(`
+	SELECT item_history.itemID, item_history.itemName, item_history.firstSeen,
+		(SELECT MAX(newest.firstSeen) FROM item_history newest WHERE newest.itemID = item_history.itemID)
+	FROM item_history
+	WHERE item_history.itemName=?
+	ORDER BY item_history.firstSeen, item_history.itemID`)
+	return s.queryItemNames(ctx, "ResolveItemName", stmt, name)
+}
+
+func (s *SQLStore) queryItemNames(ctx context.Context, caller string, stmt string, args ...any) ([]ItemName, error) {
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error %s query: %w", caller, err)
+	}
+	defer rows.Close()
+
+	var names []ItemName
+	for rows.Next() {
+		var name ItemName
+		var firstSeen, newest any
+		if err := rows.Scan(&name.ItemID, &name.Name, &firstSeen, &newest); err != nil {
+			return nil, fmt.Errorf("error %s scan: %w", caller, err)
+		}
+		if name.FirstSeen, err = scanTime(firstSeen); err != nil {
+			return nil, fmt.Errorf("error %s %w", caller, err)
+		}
+		newestSeen, err := scanTime(newest)
+		if err != nil {
+			return nil, fmt.Errorf("error %s %w", caller, err)
+		}
+		name.Current = name.FirstSeen.Equal(newestSeen)
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error %s rows: %w", caller, err)
+	}
+	return names, nil
+}
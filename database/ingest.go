@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// Run is one ingestion run. Ingest writes all of it or none of it.
+type Run struct {
+	Items []structs.Items
+	// itemIDs Trans trades that may not be in item yet (ex. new items ColdFront's
+	// item list hasn't caught up with). Missing ones are added with a NULL itemName
+	// so the trades aren't lost, the next Items with them names them.
+	UnnamedItems []int
+	MafiaPrices  []structs.MafiaPrices
+	// ColdFront latest prices, stored with MarketPricesFetched (zero is now).
+	MarketPrices        []structs.MarketPrices
+	MarketPricesFetched time.Time
+	Trans               []structs.MarketTrans
+	// Recorded in dbUpdate as a SyncSource run of len(Trans) rows in the same transaction.
+	// Zero leaves dbUpdate alone.
+	// Only set it when Trans covers everything up to that time since Sync resumes from it.
+	Watermark time.Time
+	// Rows per statement. <1 uses DefaultBatchSize.
+	BatchSize int
+}
+
+// Ingest writes run inside a single *sql.Tx. Items go first so the prices and
+// transactions that reference them can see them. Any failure rolls the whole
+// run back, watermark included.
+func (s *SQLStore) Ingest(ctx context.Context, run Run) error {
+	if run.BatchSize < 1 {
+		run.BatchSize = DefaultBatchSize
+	}
+	// Read before the tx starts so it isn't queried on the tx's connection.
+	budget := s.packetBudget(ctx)
+	placeholders := s.dialect.maxPlaceholders()
+
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		seen := time.Now()
+		insertItems := func(ctx context.Context, ex execer, rows []structs.Items) error {
+			return s.insertItemsBatch(ctx, ex, rows, seen)
+		}
+		items := writer[structs.Items]{table: "item", cols: 3, rowBytes: itemBytes, insert: insertItems}
+		if err := ingestTable(ctx, tx, itemsPerID(run.Items), run.BatchSize, placeholders, budget, items); err != nil {
+			return err
+		}
+
+		unnamed := writer[int]{table: "item", cols: 1, rowBytes: unnamedItemBytes, insert: s.insertUnnamedItemsBatch}
+		if err := ingestTable(ctx, tx, run.UnnamedItems, run.BatchSize, placeholders, budget, unnamed); err != nil {
+			return err
+		}
+
+		prices := writer[structs.MafiaPrices]{table: "prices", cols: 3, rowBytes: mafiaPriceBytes, insert: s.insertMafiaPricesBatch}
+		if err := ingestTable(ctx, tx, run.MafiaPrices, run.BatchSize, placeholders, budget, prices); err != nil {
+			return err
+		}
+
+		fetched := run.MarketPricesFetched
+		if fetched.IsZero() {
+			fetched = time.Now()
+		}
+		insertMarketPrices := func(ctx context.Context, ex execer, rows []structs.MarketPrices) error {
+			return s.insertMarketPricesBatch(ctx, ex, rows, fetched)
+		}
+		marketPrices := writer[structs.MarketPrices]{table: "market_prices", cols: 3, rowBytes: marketPriceBytes, insert: insertMarketPrices}
+		if err := ingestTable(ctx, tx, run.MarketPrices, run.BatchSize, placeholders, budget, marketPrices); err != nil {
+			return err
+		}
+
+		trans := writer[structs.MarketTrans]{table: "transactions", cols: 5, rowBytes: marketTransBytes, insert: s.insertMarketTransBatch}
+		if err := ingestTable(ctx, tx, run.Trans, run.BatchSize, placeholders, budget, trans); err != nil {
+			return err
+		}
+
+		if !run.Watermark.IsZero() {
+			if err := s.recordRun(ctx, tx, RunRecord{Source: SyncSource, Finished: run.Watermark, Rows: len(run.Trans)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Writes rows batch by batch on tx, stopping at the first failure.
+// A tx is one connection so there's nothing to gain from a worker pool here.
+func ingestTable[T any](ctx context.Context, tx *sql.Tx, rows []T, size int, placeholders int, budget int, w writer[T]) error {
+	for _, span := range planBatches(rows, size, w.cols, placeholders, budget, w.rowBytes) {
+		if err := w.insert(ctx, tx, rows[span[0]:span[1]]); err != nil {
+			return fmt.Errorf("error Ingest %s rows %d-%d: %w", w.table, span[0], span[1]-1, err)
+		}
+	}
+	return nil
+}
+
+// Runs fn in a transaction. Commits if fn returns nil, rolls back otherwise (or on panic).
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error begin tx: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error commit tx: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,500 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// ErrUnknownItem is a transaction whose itemID isn't in the item table.
+// SQL backends report this as a foreign key error instead.
+var ErrUnknownItem = errors.New("itemID not in item table")
+
+// MemStore is a Store that keeps everything in maps. For tests and --dry-run,
+// no database needed. It follows the same rules as the SQL backends: prices
+// for unknown items are skipped, transactions dedup on transID, and a
+// transaction for an unknown item fails like the foreign key would.
+type MemStore struct {
+	mu     sync.Mutex
+	tables memTables
+}
+
+var _ Store = (*MemStore)(nil)
+
+// Same as the SQL tables, keyed by primary key.
+type memTables struct {
+	items    map[int]structs.Items
+	names    map[memNameKey]string
+	prices   map[int]structs.MafiaPrices
+	history  map[[2]int64]structs.MafiaPrices
+	market   map[int]memMarketPrice
+	trans    map[int]structs.MarketTrans
+	modified map[string][]time.Time
+	runs     map[memRunKey]RunRecord
+	// See AssumeItems.
+	assumed map[int]bool
+}
+
+// A dbUpdate row's key.
+type memRunKey struct {
+	source   string
+	finished int64
+}
+
+// An item_history row's key.
+type memNameKey struct {
+	itemID    int
+	firstSeen int64
+}
+
+// A market_prices row.
+type memMarketPrice struct {
+	price     structs.MarketPrices
+	fetchedAt time.Time
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{tables: memTables{
+		items:    map[int]structs.Items{},
+		names:    map[memNameKey]string{},
+		prices:   map[int]structs.MafiaPrices{},
+		history:  map[[2]int64]structs.MafiaPrices{},
+		market:   map[int]memMarketPrice{},
+		trans:    map[int]structs.MarketTrans{},
+		modified: map[string][]time.Time{},
+		runs:     map[memRunKey]RunRecord{},
+		assumed:  map[int]bool{},
+	}}
+}
+
+// AssumeItems makes itemIDs count as being in the item table without storing
+// them: prices and transactions for them go in and ItemIDs lists them, but
+// Items doesn't. --dry-run seeds it with the upstream item list (or the items a
+// loaded file refers to) so it can go through the same ingest as a database
+// that already has the items.
+func (m *MemStore) AssumeItems(itemIDs []int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range itemIDs {
+		m.tables.assumed[id] = true
+	}
+}
+
+func (t memTables) clone() memTables {
+	c := memTables{
+		items:    make(map[int]structs.Items, len(t.items)),
+		names:    make(map[memNameKey]string, len(t.names)),
+		prices:   make(map[int]structs.MafiaPrices, len(t.prices)),
+		history:  make(map[[2]int64]structs.MafiaPrices, len(t.history)),
+		market:   make(map[int]memMarketPrice, len(t.market)),
+		trans:    make(map[int]structs.MarketTrans, len(t.trans)),
+		modified: make(map[string][]time.Time, len(t.modified)),
+		runs:     make(map[memRunKey]RunRecord, len(t.runs)),
+		assumed:  t.assumed,
+	}
+	for k, v := range t.items {
+		c.items[k] = v
+	}
+	for k, v := range t.names {
+		c.names[k] = v
+	}
+	for k, v := range t.prices {
+		c.prices[k] = v
+	}
+	for k, v := range t.history {
+		c.history[k] = v
+	}
+	for k, v := range t.market {
+		c.market[k] = v
+	}
+	for k, v := range t.trans {
+		c.trans[k] = v
+	}
+	for k, v := range t.modified {
+		c.modified[k] = append([]time.Time(nil), v...)
+	}
+	for k, v := range t.runs {
+		c.runs[k] = v
+	}
+	return c
+}
+
+func (t memTables) upsertItems(items []structs.Items) {
+	seen := time.Now().UTC().Unix()
+	for _, item := range lastPerKey(items, func(item structs.Items) int { return item.ID }) {
+		if name, ok := t.newestName(item.ID); !ok || name != item.Name {
+			t.names[memNameKey{itemID: item.ID, firstSeen: seen}] = item.Name
+		}
+		t.items[item.ID] = item
+	}
+}
+
+func (t memTables) insertUnnamedItems(itemIDs []int) {
+	for _, id := range itemIDs {
+		if !t.hasItem(id) {
+			t.items[id] = structs.Items{ID: id}
+		}
+	}
+}
+
+func (t memTables) hasItem(itemID int) bool {
+	_, ok := t.items[itemID]
+	return ok || t.assumed[itemID]
+}
+
+// The name itemID was last seen under in item_history.
+func (t memTables) newestName(itemID int) (string, bool) {
+	var newest int64
+	name, found := "", false
+	for key, n := range t.names {
+		if key.itemID == itemID && (!found || key.firstSeen > newest) {
+			newest, name, found = key.firstSeen, n, true
+		}
+	}
+	return name, found
+}
+
+// Item names matching keep, oldest first then by itemID.
+func (t memTables) itemNames(keep func(ItemName) bool) []ItemName {
+	// Only each item's newest row is current, A→B→A has an older A too.
+	newest := make(map[int]int64)
+	for key := range t.names {
+		if seen, ok := newest[key.itemID]; !ok || key.firstSeen > seen {
+			newest[key.itemID] = key.firstSeen
+		}
+	}
+
+	var names []ItemName
+	for key, n := range t.names {
+		name := ItemName{
+			ItemID:    key.itemID,
+			Name:      n,
+			FirstSeen: time.Unix(key.firstSeen, 0).UTC(),
+			Current:   newest[key.itemID] == key.firstSeen,
+		}
+		if keep(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if !names[i].FirstSeen.Equal(names[j].FirstSeen) {
+			return names[i].FirstSeen.Before(names[j].FirstSeen)
+		}
+		if names[i].ItemID != names[j].ItemID {
+			return names[i].ItemID < names[j].ItemID
+		}
+		return names[i].Name < names[j].Name
+	})
+	return names
+}
+
+func (t memTables) upsertMafiaPrices(prices []structs.MafiaPrices) {
+	for _, price := range prices {
+		if !t.hasItem(price.ItemID) {
+			continue
+		}
+		t.prices[price.ItemID] = price
+		key := [2]int64{int64(price.ItemID), price.Time}
+		if _, ok := t.history[key]; !ok {
+			t.history[key] = price
+		}
+	}
+}
+
+func (t memTables) upsertMarketPrices(prices []structs.MarketPrices, fetched time.Time) {
+	for _, price := range prices {
+		if t.hasItem(price.ItemID) {
+			t.market[price.ItemID] = memMarketPrice{price: price, fetchedAt: fetched.UTC().Truncate(time.Second)}
+		}
+	}
+}
+
+// Returns the rows that failed, same as a bulk insert would.
+func (t memTables) insertMarketTrans(trans []structs.MarketTrans) []RowError {
+	var rowErrs []RowError
+	for i, tr := range trans {
+		if !t.hasItem(tr.ItemID) {
+			rowErrs = append(rowErrs, RowError{Index: i, Row: tr, Err: ErrUnknownItem})
+			continue
+		}
+		if _, ok := t.trans[tr.TransID]; !ok {
+			t.trans[tr.TransID] = tr
+		}
+	}
+	return rowErrs
+}
+
+func (t memTables) setLastModified(tableName string, modified time.Time) error {
+	table, err := timestampTable(tableName)
+	if err != nil {
+		return fmt.Errorf("error SetLastModified %w", err)
+	}
+	if table == "dbUpdate" {
+		return t.recordRun(RunRecord{Source: SyncSource, Finished: modified})
+	}
+	// DATETIME keeps whole seconds, and lastModified is the primary key.
+	modified = modified.UTC().Truncate(time.Second)
+	for _, existing := range t.modified[table] {
+		if existing.Equal(modified) {
+			return fmt.Errorf("error SetLastModified duplicate lastModified %s", modified.Format(sqlTimeFormat))
+		}
+	}
+	t.modified[table] = append(t.modified[table], modified)
+	return nil
+}
+
+func (t memTables) recordRun(run RunRecord) error {
+	if run.Source == "" {
+		return fmt.Errorf("error RecordRun empty source")
+	}
+	// Whole seconds like DATETIME. Same second replaces, like the SQL upsert.
+	run.Finished = run.Finished.UTC().Truncate(time.Second)
+	if msg := []rune(run.Err); len(msg) > maxRunError {
+		run.Err = string(msg[:maxRunError])
+	}
+	t.runs[memRunKey{source: run.Source, finished: run.Finished.Unix()}] = run
+	return nil
+}
+
+func (t memTables) lastRun(source string) (RunRecord, error) {
+	var latest RunRecord
+	for key, run := range t.runs {
+		if key.source == source && run.Err == "" && run.Finished.After(latest.Finished) {
+			latest = run
+		}
+	}
+	if latest.Source == "" {
+		return RunRecord{}, fmt.Errorf("error LastRun %s no rows: %w", source, sql.ErrNoRows)
+	}
+	return latest, nil
+}
+
+func (m *MemStore) UpsertItems(ctx context.Context, items []structs.Items) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tables.upsertItems(items)
+	return nil
+}
+
+func (m *MemStore) UpsertMafiaPrices(ctx context.Context, prices []structs.MafiaPrices) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tables.upsertMafiaPrices(prices)
+	return nil
+}
+
+func (m *MemStore) UpsertMarketPrices(ctx context.Context, prices []structs.MarketPrices, fetched time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tables.upsertMarketPrices(prices, fetched)
+	return nil
+}
+
+// Like the SQL bulk insert every row is tried and the failed ones come back in a *BulkError.
+func (m *MemStore) InsertMarketTrans(ctx context.Context, trans []structs.MarketTrans) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rowErrs := m.tables.insertMarketTrans(trans); len(rowErrs) > 0 {
+		return &BulkError{Table: "transactions", Total: len(trans), Rows: rowErrs}
+	}
+	return nil
+}
+
+func (m *MemStore) ItemIDs(ctx context.Context) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]int, 0, len(m.tables.items)+len(m.tables.assumed))
+	for id := range m.tables.items {
+		ids = append(ids, id)
+	}
+	for id := range m.tables.assumed {
+		if _, ok := m.tables.items[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (m *MemStore) ItemHistory(ctx context.Context, itemID int) ([]ItemName, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tables.itemNames(func(name ItemName) bool { return name.ItemID == itemID }), nil
+}
+
+func (m *MemStore) ResolveItemName(ctx context.Context, name string) ([]ItemName, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tables.itemNames(func(n ItemName) bool { return n.Name == name }), nil
+}
+
+func (m *MemStore) LastModified(ctx context.Context, tableName string) (time.Time, error) {
+	table, err := timestampTable(tableName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error LastModified %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if table == "dbUpdate" {
+		run, err := m.tables.lastRun(SyncSource)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error LastModified %w", err)
+		}
+		return run.Finished, nil
+	}
+	var latest time.Time
+	for _, modified := range m.tables.modified[table] {
+		if modified.After(latest) {
+			latest = modified
+		}
+	}
+	if latest.IsZero() {
+		return time.Time{}, fmt.Errorf("error LastModified no rows: %w", sql.ErrNoRows)
+	}
+	return latest, nil
+}
+
+func (m *MemStore) SetLastModified(ctx context.Context, tableName string, modified time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tables.setLastModified(tableName, modified)
+}
+
+func (m *MemStore) RecordRun(ctx context.Context, run RunRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tables.recordRun(run)
+}
+
+func (m *MemStore) LastRun(ctx context.Context, source string) (RunRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tables.lastRun(source)
+}
+
+// Ingest works on a copy and only keeps it if the whole run went in.
+func (m *MemStore) Ingest(ctx context.Context, run Run) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tables := m.tables.clone()
+	tables.upsertItems(run.Items)
+	tables.insertUnnamedItems(run.UnnamedItems)
+	tables.upsertMafiaPrices(run.MafiaPrices)
+	fetched := run.MarketPricesFetched
+	if fetched.IsZero() {
+		fetched = time.Now()
+	}
+	tables.upsertMarketPrices(run.MarketPrices, fetched)
+	if rowErrs := tables.insertMarketTrans(run.Trans); len(rowErrs) > 0 {
+		return fmt.Errorf("error Ingest transactions row %d: %w", rowErrs[0].Index, rowErrs[0].Err)
+	}
+	if !run.Watermark.IsZero() {
+		if err := tables.recordRun(RunRecord{Source: SyncSource, Finished: run.Watermark, Rows: len(run.Trans)}); err != nil {
+			return err
+		}
+	}
+	m.tables = tables
+	return nil
+}
+
+func (m *MemStore) MafiaPriceHistory(ctx context.Context, itemID int, from time.Time, to time.Time) ([]structs.MafiaPrices, error) {
+	start, end := epochRange(from, to)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prices []structs.MafiaPrices
+	for _, price := range m.tables.history {
+		if price.ItemID == itemID && price.Time >= start && price.Time <= end {
+			prices = append(prices, price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].Time < prices[j].Time })
+	return prices, nil
+}
+
+func (m *MemStore) MafiaPriceAt(ctx context.Context, itemID int, at time.Time) (structs.MafiaPrices, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest structs.MafiaPrices
+	found := false
+	for _, price := range m.tables.history {
+		if price.ItemID == itemID && price.Time <= at.Unix() && (!found || price.Time > latest.Time) {
+			latest, found = price, true
+		}
+	}
+	if !found {
+		return structs.MafiaPrices{}, fmt.Errorf("error MafiaPriceAt no rows: %w", sql.ErrNoRows)
+	}
+	return latest, nil
+}
+
+// There's no schema to migrate.
+func (m *MemStore) MigrateUp(ctx context.Context) (int, error) { return 0, nil }
+
+func (m *MemStore) MigrateDown(ctx context.Context, steps int) (int, error) { return 0, nil }
+
+func (m *MemStore) MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	return nil, nil
+}
+
+func (m *MemStore) Close() error { return nil }
+
+// Items is every stored item sorted by ID.
+func (m *MemStore) Items() []structs.Items {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	items := make([]structs.Items, 0, len(m.tables.items))
+	for _, item := range m.tables.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items
+}
+
+// MafiaPrices is every stored price sorted by ItemID.
+func (m *MemStore) MafiaPrices() []structs.MafiaPrices {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prices := make([]structs.MafiaPrices, 0, len(m.tables.prices))
+	for _, price := range m.tables.prices {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].ItemID < prices[j].ItemID })
+	return prices
+}
+
+// MarketPrices is every stored ColdFront price sorted by ItemID.
+func (m *MemStore) MarketPrices() []structs.MarketPrices {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prices := make([]structs.MarketPrices, 0, len(m.tables.market))
+	for _, stored := range m.tables.market {
+		prices = append(prices, stored.price)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].ItemID < prices[j].ItemID })
+	return prices
+}
+
+// MarketTrans is every stored transaction sorted by TransID.
+func (m *MemStore) MarketTrans() []structs.MarketTrans {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	trans := make([]structs.MarketTrans, 0, len(m.tables.trans))
+	for _, t := range m.tables.trans {
+		trans = append(trans, t)
+	}
+	sort.Slice(trans, func(i, j int) bool { return trans[i].TransID < trans[j].TransID })
+	return trans
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are NNNN_name.up.sql / NNNN_name.down.sql pairs applied in NNNN order,
+// one directory per backend (migrations/mysql, migrations/postgres, migrations/sqlite).
+// Keep the versions in step across backends. Never edit one that has shipped, add a new one instead.
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one embedded schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a Migration and whether it has been applied to the db.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Reads every embedded migration for the store's backend sorted by version.
+func (s *SQLStore) loadMigrations() ([]Migration, error) {
+	dir := path.Join("migrations", s.dialect.name())
+	files, err := fs.ReadDir(migrationFS, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("error bad migration file name %q", file.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		body, err := fs.ReadFile(migrationFS, path.Join(dir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", file.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("error migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("error migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// The driver runs one statement per Exec, so files are split on ";" line ends.
+// Good enough since none of the migrations have ";" inside a string.
+func splitStatements(script string) []string {
+	var kept []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(kept, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+func (s *SQLStore) ensureMigrationsTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, s.dialect.createMigrationsTable()); err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// Versions already applied and when.
+func (s *SQLStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := s.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT version, appliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var sqlTime any
+		if err := rows.Scan(&version, &sqlTime); err != nil {
+			return nil, fmt.Errorf("error scanning schema_migrations: %w", err)
+		}
+		appliedAt, err := scanTime(sqlTime)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing appliedAt: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Runs every statement in script then mark (the schema_migrations insert or
+// delete) with args. Postgres and SQLite do it all in one transaction so a
+// failed migration leaves nothing behind. MySQL commits DDL as it goes so a
+// failure part way through leaves the earlier statements applied and unrecorded.
+func (s *SQLStore) runScript(ctx context.Context, m Migration, script string, mark string, args ...any) error {
+	var exec execer = s.db
+	var tx *sql.Tx
+	if s.dialect.transactionalDDL() {
+		var err error
+		tx, err = s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error migration %04d_%s begin: %w", m.Version, m.Name, err)
+		}
+		defer tx.Rollback()
+		exec = tx
+	}
+
+	for _, stmt := range splitStatements(script) {
+		if _, err := exec.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	if _, err := exec.ExecContext(ctx, mark, args...); err != nil {
+		return fmt.Errorf("error recording migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error migration %04d_%s commit: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateUp applies every migration not yet in schema_migrations, oldest first.
+// Returns how many were applied.
+func (s *SQLStore) MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := s.loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := s.runScript(ctx, m, m.Up, s.dialect.insertMigration(),
+			m.Version, m.Name, time.Now().UTC().Format(sqlTimeFormat))
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrateDown reverts the newest steps applied migrations. Returns how many were reverted.
+func (s *SQLStore) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := s.loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if err := s.runScript(ctx, m, m.Down, s.dialect.deleteMigration(), m.Version); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// MigrationStatuses lists every embedded migration and whether it's applied.
+func (s *SQLStore) MigrationStatuses(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := s.loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+	}
+	return statuses, nil
+}
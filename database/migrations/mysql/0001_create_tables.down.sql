@@ -0,0 +1,6 @@
+-- Children first because of the foreign keys.
+DROP TABLE IF EXISTS prices;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS item;
+DROP TABLE IF EXISTS gameDataUpdate;
+DROP TABLE IF EXISTS dbUpdate;
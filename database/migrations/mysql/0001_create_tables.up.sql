@@ -1,23 +1,15 @@
-CREATE DATABASE IF NOT EXISTS koldb;
-USE koldb;
--- reminder to remove. using this to just get fresh start.
--- bootstrap or do something on start
-DROP TABLE IF EXISTS prices;
-DROP TABLE IF EXISTS transactions;
-DROP TABLE IF EXISTS item;
+-- Initial koldb schema. Same tables create-tables.sql used to make by hand.
+-- IF NOT EXISTS so databases made by the old create-tables.sql adopt this as
+-- their baseline, migrate up records 0001 and carries on from 0002.
 
--- CREATE DATABASE IF NOT EXISTS `e_store`
--- CREATE TABLE `e_store`.`brands`( 
--- CONSTRAINT `brand_id` FOREIGN KEY(`brand_id`) REFERENCES `e_store`.`brands`(`id`) ON DELETE RESTRICT ON UPDATE CASCADE ,
-
-CREATE TABLE item (
+CREATE TABLE IF NOT EXISTS item (
     itemID INT NOT NULL,
     -- itemName can be empty string. populate with itemID instead if null.
     itemName VARCHAR(40),
     CONSTRAINT item_pk PRIMARY KEY(itemID)
 );
 
-CREATE TABLE transactions (
+CREATE TABLE IF NOT EXISTS transactions (
     transID INT NOT NULL,
     itemID INT NOT NULL,
     volume INT NOT NULL,
@@ -28,7 +20,8 @@ CREATE TABLE transactions (
     CONSTRAINT transactions_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
 );
 
-CREATE TABLE prices (
+-- InsertMafiaPrices only inserts when the item exists, prices_fk backs that up.
+CREATE TABLE IF NOT EXISTS prices (
     itemID INT NOT NULL,
     cost INT NOT NULL,
     epochTime INT NOT NULL,
@@ -36,12 +29,12 @@ CREATE TABLE prices (
     CONSTRAINT prices_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
 );
 
-CREATE TABLE gameDataUpdate (
+CREATE TABLE IF NOT EXISTS gameDataUpdate (
     lastModified DATETIME NOT NULL,
     CONSTRAINT gameDataUpdate_pk PRIMARY KEY(lastModified)
 );
 
-CREATE TABLE dbUpdate (
+CREATE TABLE IF NOT EXISTS dbUpdate (
     lastModified DATETIME NOT NULL,
     CONSTRAINT dbUpdate_pk PRIMARY KEY(lastModified)
-);
\ No newline at end of file
+);
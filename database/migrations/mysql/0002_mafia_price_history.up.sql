@@ -0,0 +1,12 @@
+-- Every kolmafia price we've seen. prices only keeps the current one.
+CREATE TABLE mafia_price_history (
+    itemID INT NOT NULL,
+    cost INT NOT NULL,
+    epochTime INT NOT NULL,
+    CONSTRAINT mafia_price_history_pk PRIMARY KEY(itemID, epochTime),
+    CONSTRAINT mafia_price_history_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+-- Start the history off with the prices we already have.
+INSERT INTO mafia_price_history (itemID, cost, epochTime)
+SELECT itemID, cost, epochTime FROM prices;
@@ -0,0 +1,9 @@
+-- ColdFront's latest price per item, from latestprice.php. Overwritten each refresh.
+-- fetchedAt is UTC, when koldb pulled the price, ColdFront doesn't say when it was set.
+CREATE TABLE market_prices (
+    itemID INT NOT NULL,
+    cost INT NOT NULL,
+    fetchedAt DATETIME NOT NULL,
+    CONSTRAINT market_prices_pk PRIMARY KEY(itemID),
+    CONSTRAINT market_prices_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
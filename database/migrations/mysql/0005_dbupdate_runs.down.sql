@@ -0,0 +1,9 @@
+-- Only Sync's watermarks fit the old table.
+DELETE FROM dbUpdate WHERE source <> 'coldfront-trans' OR runError IS NOT NULL;
+
+ALTER TABLE dbUpdate
+    DROP PRIMARY KEY,
+    DROP COLUMN source,
+    DROP COLUMN rowCount,
+    DROP COLUMN runError,
+    ADD PRIMARY KEY(lastModified);
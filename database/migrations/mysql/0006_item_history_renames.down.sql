@@ -0,0 +1,7 @@
+-- Back to one row per name, the first time it was seen.
+DELETE h FROM item_history h
+JOIN item_history o ON o.itemID = h.itemID AND o.itemName = h.itemName AND o.firstSeen < h.firstSeen;
+
+ALTER TABLE item_history
+    DROP PRIMARY KEY,
+    ADD CONSTRAINT item_history_pk PRIMARY KEY(itemID, itemName);
@@ -0,0 +1,13 @@
+-- item_history keyed by itemID and itemName dropped a rename back to an older
+-- name (A to B to A). Key it by when the name was first seen instead so every
+-- change is a row. Rows sharing a firstSeen (both of Mr. A's names from one
+-- fetch) keep the current name, or the first one alphabetically.
+-- MySQL can't DELETE with a subquery on the same table, so it's a self join.
+DELETE h FROM item_history h
+JOIN item_history o ON o.itemID = h.itemID AND o.firstSeen = h.firstSeen AND o.itemName <> h.itemName
+JOIN item ON item.itemID = h.itemID
+WHERE o.itemName = item.itemName OR (h.itemName <> item.itemName AND o.itemName < h.itemName);
+
+ALTER TABLE item_history
+    DROP PRIMARY KEY,
+    ADD CONSTRAINT item_history_pk PRIMARY KEY(itemID, firstSeen);
@@ -0,0 +1,40 @@
+-- Initial koldb schema. Same tables as mysql/0001 with Postgres types.
+-- IF NOT EXISTS so databases made by the old create-tables.sql adopt this as
+-- their baseline, migrate up records 0001 and carries on from 0002.
+
+CREATE TABLE IF NOT EXISTS item (
+    itemID INTEGER NOT NULL,
+    -- itemName can be empty string. populate with itemID instead if null.
+    itemName VARCHAR(40),
+    CONSTRAINT item_pk PRIMARY KEY(itemID)
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    transID INTEGER NOT NULL,
+    itemID INTEGER NOT NULL,
+    volume INTEGER NOT NULL,
+    cost DECIMAL(11,2) NOT NULL,
+    epochTime INTEGER NOT NULL,
+    CONSTRAINT transactions_pk PRIMARY KEY(transID),
+    CONSTRAINT transactions_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+-- UpsertMafiaPrices only inserts when the item exists, prices_fk backs that up.
+CREATE TABLE IF NOT EXISTS prices (
+    itemID INTEGER NOT NULL,
+    cost INTEGER NOT NULL,
+    epochTime INTEGER NOT NULL,
+    CONSTRAINT prices_pk PRIMARY KEY(itemID),
+    CONSTRAINT prices_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+-- TIMESTAMP without time zone. Everything written is already UTC.
+CREATE TABLE IF NOT EXISTS gameDataUpdate (
+    lastModified TIMESTAMP NOT NULL,
+    CONSTRAINT gameDataUpdate_pk PRIMARY KEY(lastModified)
+);
+
+CREATE TABLE IF NOT EXISTS dbUpdate (
+    lastModified TIMESTAMP NOT NULL,
+    CONSTRAINT dbUpdate_pk PRIMARY KEY(lastModified)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mafia_price_history;
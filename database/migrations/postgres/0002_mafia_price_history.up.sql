@@ -0,0 +1,12 @@
+-- Every kolmafia price we've seen. prices only keeps the current one.
+CREATE TABLE mafia_price_history (
+    itemID INTEGER NOT NULL,
+    cost INTEGER NOT NULL,
+    epochTime INTEGER NOT NULL,
+    CONSTRAINT mafia_price_history_pk PRIMARY KEY(itemID, epochTime),
+    CONSTRAINT mafia_price_history_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+-- Start the history off with the prices we already have.
+INSERT INTO mafia_price_history (itemID, cost, epochTime)
+SELECT itemID, cost, epochTime FROM prices;
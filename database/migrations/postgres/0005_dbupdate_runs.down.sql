@@ -0,0 +1,8 @@
+-- Only Sync's watermarks fit the old table.
+DELETE FROM dbUpdate WHERE source <> 'coldfront-trans' OR runError IS NOT NULL;
+
+ALTER TABLE dbUpdate DROP CONSTRAINT dbUpdate_pk;
+ALTER TABLE dbUpdate DROP COLUMN source;
+ALTER TABLE dbUpdate DROP COLUMN rowCount;
+ALTER TABLE dbUpdate DROP COLUMN runError;
+ALTER TABLE dbUpdate ADD CONSTRAINT dbUpdate_pk PRIMARY KEY(lastModified);
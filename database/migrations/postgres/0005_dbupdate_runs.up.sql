@@ -0,0 +1,9 @@
+-- dbUpdate becomes a log of fetch runs, one row per run per source (the daemon's
+-- job names, ex. kolmafia-prices). The rows already there are Sync's watermarks,
+-- which are coldfront-trans runs. runError is NULL for runs that worked, only
+-- those count as a source's last run.
+ALTER TABLE dbUpdate ADD COLUMN source VARCHAR(40) NOT NULL DEFAULT 'coldfront-trans';
+ALTER TABLE dbUpdate ADD COLUMN rowCount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE dbUpdate ADD COLUMN runError VARCHAR(255);
+ALTER TABLE dbUpdate DROP CONSTRAINT dbUpdate_pk;
+ALTER TABLE dbUpdate ADD CONSTRAINT dbUpdate_pk PRIMARY KEY(source, lastModified);
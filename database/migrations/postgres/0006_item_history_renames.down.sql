@@ -0,0 +1,9 @@
+-- Back to one row per name, the first time it was seen.
+DELETE FROM item_history h
+WHERE EXISTS (
+    SELECT 1 FROM item_history o
+    WHERE o.itemID = h.itemID AND o.itemName = h.itemName AND o.firstSeen < h.firstSeen
+);
+
+ALTER TABLE item_history DROP CONSTRAINT item_history_pk;
+ALTER TABLE item_history ADD CONSTRAINT item_history_pk PRIMARY KEY(itemID, itemName);
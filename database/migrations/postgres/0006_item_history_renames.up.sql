@@ -0,0 +1,15 @@
+-- item_history keyed by itemID and itemName dropped a rename back to an older
+-- name (A to B to A). Key it by when the name was first seen instead so every
+-- change is a row. Rows sharing a firstSeen (both of Mr. A's names from one
+-- fetch) keep the current name, or the first one alphabetically.
+DELETE FROM item_history h
+WHERE EXISTS (
+    SELECT 1 FROM item_history o
+    JOIN item ON item.itemID = o.itemID
+    WHERE o.itemID = h.itemID AND o.firstSeen = h.firstSeen
+    AND o.itemName <> h.itemName
+    AND (o.itemName = item.itemName OR (h.itemName <> item.itemName AND o.itemName < h.itemName))
+);
+
+ALTER TABLE item_history DROP CONSTRAINT item_history_pk;
+ALTER TABLE item_history ADD CONSTRAINT item_history_pk PRIMARY KEY(itemID, firstSeen);
@@ -0,0 +1,13 @@
+-- Every name an item has had, with when koldb first saw it (UTC). item only
+-- keeps the latest, this is so old names (Mr. A) still resolve to an itemID.
+CREATE TABLE item_history (
+    itemID INTEGER NOT NULL,
+    itemName VARCHAR(40) NOT NULL,
+    firstSeen DATETIME NOT NULL,
+    CONSTRAINT item_history_pk PRIMARY KEY(itemID, itemName),
+    CONSTRAINT item_history_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+-- Start with the names we already have.
+INSERT INTO item_history (itemID, itemName, firstSeen)
+SELECT itemID, itemName, CURRENT_TIMESTAMP FROM item WHERE itemName IS NOT NULL;
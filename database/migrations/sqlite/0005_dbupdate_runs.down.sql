@@ -0,0 +1,10 @@
+-- Only Sync's watermarks fit the old table.
+CREATE TABLE dbUpdate_old (
+    lastModified DATETIME NOT NULL,
+    CONSTRAINT dbUpdate_pk PRIMARY KEY(lastModified)
+);
+
+INSERT INTO dbUpdate_old (lastModified)
+SELECT lastModified FROM dbUpdate WHERE source = 'coldfront-trans' AND runError IS NULL;
+DROP TABLE dbUpdate;
+ALTER TABLE dbUpdate_old RENAME TO dbUpdate;
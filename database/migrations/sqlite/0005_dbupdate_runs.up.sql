@@ -0,0 +1,16 @@
+-- dbUpdate becomes a log of fetch runs, one row per run per source (the daemon's
+-- job names, ex. kolmafia-prices). The rows already there are Sync's watermarks,
+-- which are coldfront-trans runs. runError is NULL for runs that worked, only
+-- those count as a source's last run.
+-- SQLite can't change a primary key so the table is rebuilt.
+CREATE TABLE dbUpdate_new (
+    source VARCHAR(40) NOT NULL DEFAULT 'coldfront-trans',
+    lastModified DATETIME NOT NULL,
+    rowCount INTEGER NOT NULL DEFAULT 0,
+    runError VARCHAR(255),
+    CONSTRAINT dbUpdate_pk PRIMARY KEY(source, lastModified)
+);
+
+INSERT INTO dbUpdate_new (lastModified) SELECT lastModified FROM dbUpdate;
+DROP TABLE dbUpdate;
+ALTER TABLE dbUpdate_new RENAME TO dbUpdate;
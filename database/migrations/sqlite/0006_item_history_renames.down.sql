@@ -0,0 +1,19 @@
+-- Back to one row per name, the first time it was seen.
+DELETE FROM item_history
+WHERE EXISTS (
+    SELECT 1 FROM item_history o
+    WHERE o.itemID = item_history.itemID AND o.itemName = item_history.itemName
+    AND o.firstSeen < item_history.firstSeen
+);
+
+CREATE TABLE item_history_new (
+    itemID INTEGER NOT NULL,
+    itemName VARCHAR(40) NOT NULL,
+    firstSeen DATETIME NOT NULL,
+    CONSTRAINT item_history_pk PRIMARY KEY(itemID, itemName),
+    CONSTRAINT item_history_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+INSERT INTO item_history_new (itemID, itemName, firstSeen) SELECT itemID, itemName, firstSeen FROM item_history;
+DROP TABLE item_history;
+ALTER TABLE item_history_new RENAME TO item_history;
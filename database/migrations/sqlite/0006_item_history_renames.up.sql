@@ -0,0 +1,25 @@
+-- item_history keyed by itemID and itemName dropped a rename back to an older
+-- name (A to B to A). Key it by when the name was first seen instead so every
+-- change is a row. Rows sharing a firstSeen (both of Mr. A's names from one
+-- fetch) keep the current name, or the first one alphabetically.
+DELETE FROM item_history
+WHERE EXISTS (
+    SELECT 1 FROM item_history o
+    JOIN item ON item.itemID = o.itemID
+    WHERE o.itemID = item_history.itemID AND o.firstSeen = item_history.firstSeen
+    AND o.itemName <> item_history.itemName
+    AND (o.itemName = item.itemName OR (item_history.itemName <> item.itemName AND o.itemName < item_history.itemName))
+);
+
+-- SQLite can't change a primary key so the table is rebuilt.
+CREATE TABLE item_history_new (
+    itemID INTEGER NOT NULL,
+    itemName VARCHAR(40) NOT NULL,
+    firstSeen DATETIME NOT NULL,
+    CONSTRAINT item_history_pk PRIMARY KEY(itemID, firstSeen),
+    CONSTRAINT item_history_fk FOREIGN KEY (itemID) REFERENCES item(itemID) ON DELETE CASCADE
+);
+
+INSERT INTO item_history_new (itemID, itemName, firstSeen) SELECT itemID, itemName, firstSeen FROM item_history;
+DROP TABLE item_history;
+ALTER TABLE item_history_new RENAME TO item_history;
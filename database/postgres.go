@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	// Registers "postgres".
+	_ "github.com/lib/pq"
+)
+
+// postgresDialect is for the shared Postgres. Identifiers are left unquoted so
+// Postgres folds them to lowercase everywhere (itemID is itemid) and they still match.
+type postgresDialect struct{}
+
+func (postgresDialect) name() string             { return DriverPostgres }
+func (postgresDialect) driverName() string       { return "postgres" }
+func (postgresDialect) bind(query string) string { return rebind(query) }
+
+// lib/pq takes either a postgres:// URL or key=value pairs as is.
+func (postgresDialect) dsn(dsn string) string { return dsn }
+
+func (postgresDialect) maxOpenConns() int { return DefaultWorkers }
+
+// The wire protocol counts bind parameters in 16 bits.
+func (postgresDialect) maxPlaceholders() int { return 65535 }
+
+func (postgresDialect) transactionalDDL() bool { return true }
+
+// Postgres messages can be up to 1GB. Keeps batches from getting silly.
+func (postgresDialect) packetBudget(ctx context.Context, db *sql.DB) int { return 16 << 20 }
+
+// Postgres wants $1, $2... instead of ?. None of our statements have a ? anywhere else.
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (postgresDialect) upsertItems(rows int) string {
+	return rebind(`
+	INSERT INTO item (itemID, itemName)
+	VALUES ` + valuesList(rows, 2) + `
+	ON CONFLICT (itemID) DO UPDATE SET itemName=EXCLUDED.itemName`)
+}
+
+func (postgresDialect) insertUnnamedItems(rows int) string {
+	return rebind(`
+	INSERT INTO item (itemID)
+	VALUES ` + valuesList(rows, 1) + `
+	ON CONFLICT (itemID) DO NOTHING`)
+}
+
+func (postgresDialect) insertItemHistory(rows int) string {
+	return rebind(`
+	INSERT INTO item_history (itemID, itemName, firstSeen)
+	SELECT v.itemID, v.itemName, v.firstSeen
+	FROM (VALUES ` + castValues(rows, "integer", "varchar", "timestamp") + `) AS v (itemID, itemName, firstSeen)
+	WHERE v.itemName IS DISTINCT FROM (
+		SELECT h.itemName FROM item_history h WHERE h.itemID = v.itemID
+		ORDER BY h.firstSeen DESC LIMIT 1)
+	ON CONFLICT (itemID, firstSeen) DO UPDATE SET itemName=EXCLUDED.itemName`)
+}
+
+// Outside of a plain INSERT ... VALUES Postgres can't tell what type a
+// parameter is, so each one is cast.
+func castValues(rows int, types ...string) string {
+	casts := make([]string, len(types))
+	for i, t := range types {
+		casts[i] = "?::" + t
+	}
+	row := "(" + strings.Join(casts, ", ") + ")"
+	return strings.TrimSuffix(strings.Repeat(row+", ", rows), ", ")
+}
+
+func (postgresDialect) upsertMafiaPrices(rows int) string {
+	// The JOIN drops items not in `item` same as the MySQL version.
+	return rebind(`
+	INSERT INTO prices (itemID, cost, epochTime)
+	SELECT v.itemID, v.cost, v.epochTime
+	FROM (VALUES ` + castValues(rows, "integer", "integer", "integer") + `) AS v (itemID, cost, epochTime)
+	JOIN item ON item.itemID = v.itemID
+	ON CONFLICT (itemID) DO UPDATE SET cost=EXCLUDED.cost, epochTime=EXCLUDED.epochTime`)
+}
+
+func (postgresDialect) insertMafiaPriceHistory(rows int) string {
+	return rebind(`
+	INSERT INTO mafia_price_history (itemID, cost, epochTime)
+	SELECT v.itemID, v.cost, v.epochTime
+	FROM (VALUES ` + castValues(rows, "integer", "integer", "integer") + `) AS v (itemID, cost, epochTime)
+	JOIN item ON item.itemID = v.itemID
+	ON CONFLICT (itemID, epochTime) DO NOTHING`)
+}
+
+func (postgresDialect) upsertMarketPrices(rows int) string {
+	return rebind(`
+	INSERT INTO market_prices (itemID, cost, fetchedAt)
+	SELECT v.itemID, v.cost, v.fetchedAt
+	FROM (VALUES ` + castValues(rows, "integer", "integer", "timestamp") + `) AS v (itemID, cost, fetchedAt)
+	JOIN item ON item.itemID = v.itemID
+	ON CONFLICT (itemID) DO UPDATE SET cost=EXCLUDED.cost, fetchedAt=EXCLUDED.fetchedAt`)
+}
+
+func (postgresDialect) insertMarketTrans(rows int) string {
+	// Unlike MySQL's INSERT IGNORE this only skips the transID conflict, other errors still come back.
+	return rebind(`
+	INSERT INTO transactions (transID, itemID, volume, cost, epochTime)
+	VALUES ` + valuesList(rows, 5) + `
+	ON CONFLICT (transID) DO NOTHING`)
+}
+
+func (postgresDialect) insertModified(table string) string {
+	return fmt.Sprintf(`INSERT INTO %s (lastModified) VALUES ($1)`, table)
+}
+
+func (postgresDialect) lastModified(table string) string {
+	return fmt.Sprintf(`SELECT lastModified FROM %s ORDER BY lastModified DESC LIMIT 1`, table)
+}
+
+func (postgresDialect) insertRun() string {
+	return `
+	INSERT INTO dbUpdate (source, lastModified, rowCount, runError)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (source, lastModified) DO UPDATE SET rowCount = excluded.rowCount, runError = excluded.runError`
+}
+
+func (postgresDialect) lastRun() string {
+	return `
+	SELECT lastModified, rowCount FROM dbUpdate
+	WHERE source = $1 AND runError IS NULL
+	ORDER BY lastModified DESC LIMIT 1`
+}
+
+func (postgresDialect) createMigrationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		appliedAt TIMESTAMP NOT NULL,
+		CONSTRAINT schema_migrations_pk PRIMARY KEY(version)
+	)`
+}
+
+func (postgresDialect) insertMigration() string {
+	return `INSERT INTO schema_migrations (version, name, appliedAt) VALUES ($1, $2, $3)`
+}
+
+func (postgresDialect) deleteMigration() string {
+	return `DELETE FROM schema_migrations WHERE version=$1`
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SyncSource is the dbUpdate source Sync's watermarks are recorded under.
+// Same as the ColdFront transactions data.Source name.
+const SyncSource = "coldfront-trans"
+
+// Longest runError dbUpdate holds.
+const maxRunError = 255
+
+// RunRecord is one row of dbUpdate: a fetch of Source that finished at Finished.
+// For SyncSource, Finished is the watermark Sync resumes from.
+type RunRecord struct {
+	Source   string
+	Finished time.Time
+	// Rows stored.
+	Rows int
+	// Why the run failed, "" if it worked.
+	Err string
+}
+
+// Cuts Err down to what fits in runError.
+func (r RunRecord) runError() sql.NullString {
+	if r.Err == "" {
+		return sql.NullString{}
+	}
+	runes := []rune(r.Err)
+	if len(runes) > maxRunError {
+		runes = runes[:maxRunError]
+	}
+	return sql.NullString{String: string(runes), Valid: true}
+}
+
+func (s *SQLStore) RecordRun(ctx context.Context, run RunRecord) error {
+	return s.recordRun(ctx, s.db, run)
+}
+
+func (s *SQLStore) recordRun(ctx context.Context, ex execer, run RunRecord) error {
+	if run.Source == "" {
+		return fmt.Errorf("error RecordRun empty source")
+	}
+	// UTC used for consistency like setLastModified.
+	finished := run.Finished.UTC().Format(sqlTimeFormat)
+	if _, err := ex.ExecContext(ctx, s.dialect.insertRun(), run.Source, finished, run.Rows, run.runError()); err != nil {
+		return fmt.Errorf("error RecordRun db.Exec() %w", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) LastRun(ctx context.Context, source string) (RunRecord, error) {
+	var sqlTime any
+	run := RunRecord{Source: source}
+	row := s.db.QueryRowContext(ctx, s.dialect.lastRun(), source)
+	if err := row.Scan(&sqlTime, &run.Rows); err != nil {
+		if err == sql.ErrNoRows {
+			return RunRecord{}, fmt.Errorf("error LastRun %s no rows: %w", source, err)
+		}
+		return RunRecord{}, fmt.Errorf("error LastRun scan: %w", err)
+	}
+
+	finished, err := scanTime(sqlTime)
+	if err != nil {
+		return RunRecord{}, fmt.Errorf("error LastRun %w", err)
+	}
+	run.Finished = finished
+	return run, nil
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	// Pure Go (modernc) SQLite so koldb builds without cgo. Registers "sqlite".
+	_ "github.com/glebarez/go-sqlite"
+)
+
+// sqliteDialect is for running koldb off a single local file, no server needed.
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string             { return DriverSQLite }
+func (sqliteDialect) driverName() string       { return "sqlite" }
+func (sqliteDialect) bind(query string) string { return query }
+
+// Foreign keys are off by default in SQLite and the prices rule depends on them.
+// busy_timeout waits on a locked file instead of failing right away.
+func (sqliteDialect) dsn(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
+
+// SQLite allows one writer at a time. More connections just means more "database is locked".
+func (sqliteDialect) maxOpenConns() int { return 1 }
+
+// SQLITE_MAX_VARIABLE_NUMBER since 3.32.
+func (sqliteDialect) maxPlaceholders() int { return 32766 }
+
+func (sqliteDialect) transactionalDDL() bool { return true }
+
+// No packet to fit in. Keeps batches from getting silly.
+func (sqliteDialect) packetBudget(ctx context.Context, db *sql.DB) int { return 16 << 20 }
+
+func (sqliteDialect) upsertItems(rows int) string {
+	return `
+	INSERT INTO item (itemID, itemName)
+	VALUES ` + valuesList(rows, 2) + `
+	ON CONFLICT(itemID) DO UPDATE SET itemName=excluded.itemName`
+}
+
+func (sqliteDialect) insertUnnamedItems(rows int) string {
+	return `
+	INSERT INTO item (itemID)
+	VALUES ` + valuesList(rows, 1) + `
+	ON CONFLICT(itemID) DO NOTHING`
+}
+
+func (sqliteDialect) insertItemHistory(rows int) string {
+	return `
+	INSERT INTO item_history (itemID, itemName, firstSeen)
+	SELECT column1, column2, column3
+	FROM (VALUES ` + valuesList(rows, 3) + `)
+	WHERE column2 IS NOT (
+		SELECT h.itemName FROM item_history h WHERE h.itemID = column1
+		ORDER BY h.firstSeen DESC LIMIT 1)
+	ON CONFLICT(itemID, firstSeen) DO UPDATE SET itemName=excluded.itemName`
+}
+
+func (sqliteDialect) upsertMafiaPrices(rows int) string {
+	// VALUES names its columns column1, column2... The WHERE keeps prices to
+	// items in `item` and also stops SQLite reading ON CONFLICT as a join constraint.
+	return `
+	INSERT INTO prices (itemID, cost, epochTime)
+	SELECT column1, column2, column3
+	FROM (VALUES ` + valuesList(rows, 3) + `)
+	WHERE column1 IN (SELECT itemID FROM item)
+	ON CONFLICT(itemID) DO UPDATE SET cost=excluded.cost, epochTime=excluded.epochTime`
+}
+
+func (sqliteDialect) insertMafiaPriceHistory(rows int) string {
+	return `
+	INSERT INTO mafia_price_history (itemID, cost, epochTime)
+	SELECT column1, column2, column3
+	FROM (VALUES ` + valuesList(rows, 3) + `)
+	WHERE column1 IN (SELECT itemID FROM item)
+	ON CONFLICT(itemID, epochTime) DO NOTHING`
+}
+
+func (sqliteDialect) upsertMarketPrices(rows int) string {
+	return `
+	INSERT INTO market_prices (itemID, cost, fetchedAt)
+	SELECT column1, column2, column3
+	FROM (VALUES ` + valuesList(rows, 3) + `)
+	WHERE column1 IN (SELECT itemID FROM item)
+	ON CONFLICT(itemID) DO UPDATE SET cost=excluded.cost, fetchedAt=excluded.fetchedAt`
+}
+
+func (sqliteDialect) insertMarketTrans(rows int) string {
+	return `
+	INSERT INTO transactions (transID, itemID, volume, cost, epochTime)
+	VALUES ` + valuesList(rows, 5) + `
+	ON CONFLICT(transID) DO NOTHING`
+}
+
+func (sqliteDialect) insertModified(table string) string {
+	return fmt.Sprintf(`INSERT INTO %s (lastModified) VALUES (?)`, table)
+}
+
+func (sqliteDialect) lastModified(table string) string {
+	return fmt.Sprintf(`SELECT lastModified FROM %s ORDER BY lastModified DESC LIMIT 1`, table)
+}
+
+func (sqliteDialect) insertRun() string {
+	return `
+	INSERT INTO dbUpdate (source, lastModified, rowCount, runError)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (source, lastModified) DO UPDATE SET rowCount = excluded.rowCount, runError = excluded.runError`
+}
+
+func (sqliteDialect) lastRun() string {
+	return `
+	SELECT lastModified, rowCount FROM dbUpdate
+	WHERE source = ? AND runError IS NULL
+	ORDER BY lastModified DESC LIMIT 1`
+}
+
+func (sqliteDialect) createMigrationsTable() string {
+	return `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		appliedAt DATETIME NOT NULL,
+		CONSTRAINT schema_migrations_pk PRIMARY KEY(version)
+	)`
+}
+
+func (sqliteDialect) insertMigration() string {
+	return `INSERT INTO schema_migrations (version, name, appliedAt) VALUES (?, ?, ?)`
+}
+
+func (sqliteDialect) deleteMigration() string {
+	return `DELETE FROM schema_migrations WHERE version=?`
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// A migrated SQLite store in a temp dir.
+func newSQLiteStore(t *testing.T) *SQLStore {
+	t.Helper()
+	ctx := context.Background()
+	store, err := Open(ctx, Config{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "koldb.db")})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := store.(*SQLStore)
+	if _, err := s.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+	return s
+}
+
+// Runs test against a MemStore, a SQLite store and, if KOLDB_TEST_POSTGRES_DSN
+// is set, a Postgres store, which should all agree.
+func eachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	stores := map[string]func(t *testing.T) Store{
+		"memory":   func(*testing.T) Store { return NewMemStore() },
+		"sqlite":   func(t *testing.T) Store { return newSQLiteStore(t) },
+		"postgres": func(t *testing.T) Store { return newPostgresStore(t) },
+	}
+	for name, newStore := range stores {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			test(t, newStore(t))
+		})
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	stores := map[string]func(t *testing.T) *SQLStore{
+		"sqlite":   newSQLiteStore,
+		"postgres": newPostgresStore,
+	}
+	for name, newStore := range stores {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			s := newStore(t)
+			migrations, err := s.loadMigrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reverted, err := s.MigrateDown(ctx, len(migrations))
+			if err != nil || reverted != len(migrations) {
+				t.Fatalf("MigrateDown() = %d, %v, want %d", reverted, err, len(migrations))
+			}
+			applied, err := s.MigrateUp(ctx)
+			if err != nil || applied != len(migrations) {
+				t.Fatalf("MigrateUp() = %d, %v, want %d", applied, err, len(migrations))
+			}
+		})
+	}
+}
+
+func TestIngestUnknownItemFails(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		err := store.Ingest(ctx, Run{
+			Items:     []structs.Items{{ID: 1, Name: "known"}},
+			Trans:     []structs.MarketTrans{{TransID: 1, ItemID: 1, Volume: 1, Price: 1, Time: 1}, {TransID: 2, ItemID: 2, Volume: 1, Price: 1, Time: 1}},
+			Watermark: time.Unix(1700000000, 0),
+		})
+		if err == nil {
+			t.Fatal("Ingest() with an unknown item's trade worked, want the foreign key error")
+		}
+		// All or nothing.
+		if ids, _ := store.ItemIDs(ctx); len(ids) != 0 {
+			t.Errorf("ItemIDs() = %v after a failed Ingest, want none", ids)
+		}
+	})
+}
+
+func TestIngestRollsBackWatermark(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		first := time.Unix(1700000000, 0).UTC()
+		err := store.Ingest(ctx, Run{
+			Items:     []structs.Items{{ID: 1, Name: "known"}},
+			Trans:     []structs.MarketTrans{{TransID: 1, ItemID: 1, Volume: 1, Price: 1, Time: 1}},
+			Watermark: first,
+		})
+		if err != nil {
+			t.Fatalf("Ingest() error = %v", err)
+		}
+
+		// The second trade's item doesn't exist, so the whole run goes.
+		err = store.Ingest(ctx, Run{
+			Trans:     []structs.MarketTrans{{TransID: 2, ItemID: 1, Volume: 1, Price: 1, Time: 2}, {TransID: 3, ItemID: 2, Volume: 1, Price: 1, Time: 2}},
+			Watermark: first.Add(time.Hour),
+		})
+		if err == nil {
+			t.Fatal("Ingest() with an unknown item's trade worked, want the foreign key error")
+		}
+		if last, err := store.LastModified(ctx, "dbUpdate"); err != nil || !last.Equal(first) {
+			t.Errorf("LastModified() = %v, %v after a failed Ingest, want the first watermark %v", last, err, first)
+		}
+		if run, err := store.LastRun(ctx, SyncSource); err != nil || run.Rows != 1 {
+			t.Errorf("LastRun() = %+v, %v, want the first run's 1 row", run, err)
+		}
+
+		// Redoing the run without the bad trade moves the watermark on.
+		if err := store.Ingest(ctx, Run{Trans: []structs.MarketTrans{{TransID: 2, ItemID: 1, Volume: 1, Price: 1, Time: 2}}, Watermark: first.Add(time.Hour)}); err != nil {
+			t.Fatalf("Ingest() retry error = %v", err)
+		}
+		if last, err := store.LastModified(ctx, "dbUpdate"); err != nil || !last.Equal(first.Add(time.Hour)) {
+			t.Errorf("LastModified() = %v, %v after the retry, want %v", last, err, first.Add(time.Hour))
+		}
+	})
+}
+
+func TestIngestUnnamedItems(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		err := store.Ingest(ctx, Run{
+			Items:        []structs.Items{{ID: 1, Name: "known"}},
+			UnnamedItems: []int{1, 2, 2},
+			Trans:        []structs.MarketTrans{{TransID: 1, ItemID: 1, Volume: 1, Price: 1, Time: 1}, {TransID: 2, ItemID: 2, Volume: 1, Price: 1, Time: 1}},
+		})
+		if err != nil {
+			t.Fatalf("Ingest() error = %v", err)
+		}
+		if ids, _ := store.ItemIDs(ctx); len(ids) != 2 {
+			t.Errorf("ItemIDs() = %v, want 1 and 2", ids)
+		}
+		// An item already there keeps its name.
+		if names, _ := store.ItemHistory(ctx, 1); len(names) != 1 || names[0].Name != "known" || !names[0].Current {
+			t.Errorf("ItemHistory(1) = %+v, want just known", names)
+		}
+		if names, _ := store.ItemHistory(ctx, 2); len(names) != 0 {
+			t.Errorf("ItemHistory(2) = %+v, want none before the item list names it", names)
+		}
+
+		if err := store.Ingest(ctx, Run{Items: []structs.Items{{ID: 2, Name: "new item"}}}); err != nil {
+			t.Fatalf("Ingest() naming error = %v", err)
+		}
+		if names, _ := store.ItemHistory(ctx, 2); len(names) != 1 || names[0].Name != "new item" || !names[0].Current {
+			t.Errorf("ItemHistory(2) = %+v, want new item", names)
+		}
+	})
+}
+
+func TestItemHistoryRenames(t *testing.T) {
+	eachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		// firstSeen is to the second, so each fetch needs its own.
+		for i, items := range [][]structs.Items{
+			// Mr. A style duplicate, the last name wins.
+			{{ID: 1, Name: "A"}, {ID: 2, Name: "old"}, {ID: 2, Name: "new"}},
+			{{ID: 1, Name: "B"}, {ID: 2, Name: "old"}, {ID: 2, Name: "new"}},
+			{{ID: 1, Name: "A"}},
+			{{ID: 1, Name: "A"}},
+		} {
+			if i > 0 {
+				time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+			}
+			if err := store.Ingest(ctx, Run{Items: items}); err != nil {
+				t.Fatalf("Ingest() error = %v", err)
+			}
+		}
+
+		history, err := store.ItemHistory(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, name := range history {
+			names = append(names, name.Name)
+		}
+		if len(names) != 3 || names[0] != "A" || names[1] != "B" || names[2] != "A" {
+			t.Errorf("ItemHistory(1) names = %v, want [A B A]", names)
+		}
+		// Only the second A is what the item is called now.
+		if len(history) == 3 && (history[0].Current || history[1].Current || !history[2].Current) {
+			t.Errorf("ItemHistory(1) = %+v, want only the last A current", history)
+		}
+		if resolved, _ := store.ResolveItemName(ctx, "A"); len(resolved) != 2 || resolved[0].Current || !resolved[1].Current {
+			t.Errorf("ResolveItemName(A) = %+v, want two rows, the newer current", resolved)
+		}
+
+		history, err = store.ItemHistory(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Name != "new" || !history[0].Current {
+			t.Errorf("ItemHistory(2) = %+v, want only the current name", history)
+		}
+	})
+}
+
+func TestItemsDedupedAcrossBatches(t *testing.T) {
+	ctx := context.Background()
+	store, err := Open(ctx, Config{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "koldb.db"), Bulk: BulkOptions{BatchSize: 1}})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	s := store.(*SQLStore)
+	if _, err := s.MigrateUp(ctx); err != nil {
+		t.Fatalf("MigrateUp() error = %v", err)
+	}
+
+	// Mr. A's two names land in different batches.
+	items := []structs.Items{{ID: 1, Name: "Mr. A old"}, {ID: 2, Name: "other"}, {ID: 1, Name: "Mr. A"}}
+	refreshes := []func() error{
+		func() error { return s.UpsertItems(ctx, items) },
+		func() error { return s.Ingest(ctx, Run{Items: items, BatchSize: 1}) },
+		func() error { return s.UpsertItems(ctx, items) },
+	}
+	for i, refresh := range refreshes {
+		if i > 0 {
+			time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		}
+		if err := refresh(); err != nil {
+			t.Fatalf("refresh %d error = %v", i, err)
+		}
+		history, err := s.ItemHistory(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Name != "Mr. A" || !history[0].Current {
+			t.Errorf("refresh %d ItemHistory(1) = %+v, want just Mr. A", i, history)
+		}
+	}
+}
+
+func TestMemStoreAssumeItems(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemStore()
+	store.AssumeItems([]int{7})
+	err := store.Ingest(ctx, Run{
+		Trans:       []structs.MarketTrans{{TransID: 1, ItemID: 7, Volume: 1, Price: 1, Time: 1}},
+		MafiaPrices: []structs.MafiaPrices{{ItemID: 7, Time: 1, Price: 5}, {ItemID: 8, Time: 1, Price: 5}},
+	})
+	if err != nil {
+		t.Fatalf("Ingest() error = %v", err)
+	}
+	if ids, _ := store.ItemIDs(ctx); len(ids) != 1 || ids[0] != 7 {
+		t.Errorf("ItemIDs() = %v, want [7]", ids)
+	}
+	if len(store.Items()) != 0 || len(store.MarketTrans()) != 1 || len(store.MafiaPrices()) != 1 {
+		t.Errorf("stored %d item(s), %d trans, %d mafia price(s), want 0, 1, 1",
+			len(store.Items()), len(store.MarketTrans()), len(store.MafiaPrices()))
+	}
+}
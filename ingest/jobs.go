@@ -0,0 +1,106 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+)
+
+// There's a job per registered data.Source, named after it. These have their own
+// run logic, the rest just store what their Source fetches. A job's name is also
+// the dbUpdate source its runs are recorded under.
+const (
+	JobTrans  = database.SyncSource
+	JobItems  = "coldfront-items"
+	JobPrices = "coldfront-prices"
+	JobMafia  = "kolmafia-prices"
+)
+
+// Jobs is every job name, which is every data.Sources() name.
+func Jobs() []string {
+	var names []string
+	for _, src := range data.Sources() {
+		names = append(names, src.Name())
+	}
+	return names
+}
+
+// JobResult is what one RunJob did.
+type JobResult struct {
+	// Rows stored.
+	Rows int
+	// Lines or options the parser threw out. Empty for JobTrans.
+	Report data.ParseReport
+	// itemIDs stored unnamed because they were traded before the item list had them.
+	NewItems []int
+}
+
+// RunJob runs the named job once and records it in dbUpdate, failed or not.
+//   - JobTrans is Sync with opts.
+//   - JobPrices is RefreshMarketPrices.
+//   - Any other registered Source (ex. JobItems, JobMafia) fetches a full snapshot and stores it in one Ingest.
+func RunJob(ctx context.Context, store database.Store, name string, opts SyncOptions) (JobResult, error) {
+	src, ok := data.Lookup(name)
+	if !ok {
+		return JobResult{}, fmt.Errorf("error RunJob unknown job %q", name)
+	}
+
+	var result JobResult
+	var err error
+	switch name {
+	case JobTrans:
+		var synced SyncResult
+		synced, err = Sync(ctx, store, opts)
+		// The watermark Sync writes is its run record.
+		if err == nil {
+			return JobResult{Rows: synced.Rows, NewItems: synced.NewItems}, nil
+		}
+	case JobPrices:
+		var refreshed RefreshResult
+		refreshed, err = RefreshMarketPrices(ctx, store, opts.Client)
+		result = JobResult{Rows: refreshed.Stored, Report: refreshed.Report}
+	default:
+		result, err = storeSource(ctx, store, data.Configure(src, data.Options{Client: opts.Client}), opts.BatchSize)
+	}
+
+	record := database.RunRecord{Source: name, Finished: time.Now().UTC(), Rows: result.Rows}
+	if err != nil {
+		record.Err = err.Error()
+	}
+	if recordErr := store.RecordRun(ctx, record); recordErr != nil && err == nil {
+		err = fmt.Errorf("error RunJob recording %s: %w", name, recordErr)
+	}
+	return result, err
+}
+
+// Fetches a full snapshot (or the last day for windowed feeds) from src and
+// stores it as one Ingest run. Like Sync, items traded but not stored yet are added unnamed.
+func storeSource(ctx context.Context, store database.Store, src data.Source, batchSize int) (JobResult, error) {
+	batch, err := src.Fetch(ctx, data.Window{})
+	if err != nil {
+		return JobResult{}, fmt.Errorf("error fetching %s: %w", src.Name(), err)
+	}
+	var newItems []int
+	if len(batch.Trans) > 0 {
+		ids, err := store.ItemIDs(ctx)
+		if err != nil {
+			return JobResult{}, fmt.Errorf("error reading items for %s: %w", src.Name(), err)
+		}
+		newItems = UnknownItems(batch.Trans, ids)
+	}
+	run := database.Run{
+		Items:        batch.Items,
+		UnnamedItems: newItems,
+		MafiaPrices:  batch.MafiaPrices,
+		MarketPrices: batch.MarketPrices,
+		Trans:        batch.Trans,
+		BatchSize:    batchSize,
+	}
+	if err := store.Ingest(ctx, run); err != nil {
+		return JobResult{}, fmt.Errorf("error storing %s: %w", src.Name(), err)
+	}
+	return JobResult{Rows: batch.Len(), Report: batch.Report, NewItems: newItems}, nil
+}
@@ -0,0 +1,54 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+)
+
+// RefreshResult is what one RefreshMarketPrices run did.
+type RefreshResult struct {
+	Fetched time.Time
+	// Item IDs asked for.
+	Items int
+	// Prices stored.
+	Stored int
+	// IDs ColdFront had no price for, or whose chunk failed.
+	Missing []int
+	Report  data.ParseReport
+}
+
+// RefreshMarketPrices pulls the ColdFront latest price of every item in store
+// and upserts them into market_prices. Chunks that fail don't stop the rest:
+// whatever did come back is stored, then the fetch error is returned.
+// At the default rate limit this is ~5s per 10 items, so the full list takes a while.
+func RefreshMarketPrices(ctx context.Context, store database.Store, client *data.Client) (RefreshResult, error) {
+	if client == nil {
+		client = data.DefaultClient
+	}
+
+	ids, err := store.ItemIDs(ctx)
+	if err != nil {
+		return RefreshResult{}, fmt.Errorf("error RefreshMarketPrices reading items: %w", err)
+	}
+
+	result := RefreshResult{Fetched: time.Now().UTC(), Items: len(ids)}
+	prices, fetchErr := client.LatestPrices(ctx, ids)
+	result.Missing = prices.Missing
+	result.Report = prices.Report
+
+	if len(prices.Prices) > 0 {
+		run := database.Run{MarketPrices: prices.Prices, MarketPricesFetched: result.Fetched}
+		if err := store.Ingest(ctx, run); err != nil {
+			return result, fmt.Errorf("error RefreshMarketPrices storing: %w", err)
+		}
+		result.Stored = len(prices.Prices)
+	}
+	if fetchErr != nil {
+		return result, fmt.Errorf("error RefreshMarketPrices fetching: %w", fetchErr)
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+	"github.com/abramtrinh/koldb/structs"
+)
+
+// SyncOptions controls how far back Sync looks and how it fetches and stores.
+type SyncOptions struct {
+	// nil uses data.DefaultClient.
+	Client *data.Client
+	// Pulled back from the last dbUpdate so trades ColdFront records late still get picked up.
+	Overlap time.Duration
+	// How far back to go when dbUpdate is empty.
+	InitialLookback time.Duration
+	// Most of the gap held in memory and stored as one run. A longer gap is
+	// synced in spans of this, each with its own watermark. <=0 is the whole gap at once.
+	MaxSpan time.Duration
+	Plan    data.BackfillPlan
+	// Rows per INSERT. <1 uses database.DefaultBatchSize.
+	BatchSize int
+}
+
+// DefaultSyncOptions re-reads the last 10 minutes, starts a fresh db with one day
+// of history and stores at most 6 hours per run.
+var DefaultSyncOptions = SyncOptions{
+	Overlap:         10 * time.Minute,
+	InitialLookback: 24 * time.Hour,
+	MaxSpan:         6 * time.Hour,
+	Plan:            data.DefaultBackfillPlan,
+}
+
+// SyncResult is what one Sync run covered.
+type SyncResult struct {
+	Start time.Time
+	End   time.Time
+	Rows  int
+	// itemIDs traded but not in the item table yet. They're stored with no name
+	// so their trades still go in, the next item list refresh names them.
+	NewItems []int
+	Windows  []data.WindowResult
+}
+
+// Sync fetches ColdFront transactions from the last dbUpdate (minus Overlap) up
+// to now and inserts them into store, MaxSpan at a time. Each span's rows and its
+// end as the new dbUpdate watermark go in one Store.Ingest transaction, and only
+// once every window of the span was fetched, so a failed span leaves nothing
+// behind and the next Sync resumes from the last span that went in.
+// Already stored transactions are skipped by the transID dedup in InsertMarketTrans.
+// Items traded but not in the item table are added unnamed (SyncResult.NewItems)
+// in the same run, so no trade is dropped behind the new watermark.
+func Sync(ctx context.Context, store database.Store, opts SyncOptions) (SyncResult, error) {
+	client := opts.Client
+	if client == nil {
+		client = data.DefaultClient
+	}
+
+	end := time.Now().UTC()
+	last, err := store.LastModified(ctx, "dbUpdate")
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		last = end.Add(-opts.InitialLookback)
+	case err != nil:
+		return SyncResult{}, fmt.Errorf("error Sync reading watermark: %w", err)
+	}
+
+	result := SyncResult{Start: last.Add(-opts.Overlap), End: end}
+	if !result.Start.Before(result.End) {
+		return result, nil
+	}
+
+	for start := result.Start; start.Before(end); {
+		spanEnd := end
+		// Backfill works in whole seconds, so less than one left over goes in this span.
+		if opts.MaxSpan > 0 && end.Sub(start.Add(opts.MaxSpan)) >= time.Second {
+			spanEnd = start.Add(opts.MaxSpan)
+		}
+		if err := syncSpan(ctx, store, client, opts, start, spanEnd, &result); err != nil {
+			return result, err
+		}
+		start = spanEnd
+	}
+	sort.Ints(result.NewItems)
+	return result, nil
+}
+
+// Fetches and stores start to end as one run, adding what it did to result.
+func syncSpan(ctx context.Context, store database.Store, client *data.Client, opts SyncOptions, start time.Time, end time.Time, result *SyncResult) error {
+	// Held until every window is in so the span can be stored all or nothing.
+	var spanTrans []structs.MarketTrans
+	windows, err := client.Backfill(ctx, start.Unix(), end.Unix(), opts.Plan, func(window data.Window, trans []structs.MarketTrans) error {
+		spanTrans = append(spanTrans, trans...)
+		return nil
+	})
+	result.Windows = append(result.Windows, windows...)
+	if err != nil {
+		return fmt.Errorf("error Sync fetching: %w", err)
+	}
+
+	// Read again for every span, the ones before may have added items.
+	ids, err := store.ItemIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("error Sync reading items: %w", err)
+	}
+	newItems := UnknownItems(spanTrans, ids)
+
+	run := database.Run{Trans: spanTrans, UnnamedItems: newItems, Watermark: end, BatchSize: opts.BatchSize}
+	if err := store.Ingest(ctx, run); err != nil {
+		return fmt.Errorf("error Sync storing: %w", err)
+	}
+	result.Rows += len(spanTrans)
+	result.NewItems = append(result.NewItems, newItems...)
+	return nil
+}
+
+// UnknownItems is every itemID trans trades that isn't in ids, ascending.
+// Pass them as Run.UnnamedItems so the trades don't fail the foreign key.
+func UnknownItems(trans []structs.MarketTrans, ids []int) []int {
+	items := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		items[id] = true
+	}
+	var unknown []int
+	for _, tr := range trans {
+		if !items[tr.ItemID] {
+			items[tr.ItemID] = true
+			unknown = append(unknown, tr.ItemID)
+		}
+	}
+	sort.Ints(unknown)
+	return unknown
+}
@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+	"github.com/abramtrinh/koldb/structs"
+)
+
+func TestUnknownItems(t *testing.T) {
+	trans := []structs.MarketTrans{{TransID: 1, ItemID: 5}, {TransID: 2, ItemID: 2}, {TransID: 3, ItemID: 1}, {TransID: 4, ItemID: 5}}
+	if got, want := UnknownItems(trans, []int{1, 3}), []int{2, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnknownItems() = %v, want %v", got, want)
+	}
+	if got := UnknownItems(trans, []int{1, 2, 5}); got != nil {
+		t.Errorf("UnknownItems() = %v, want none", got)
+	}
+}
+
+// ColdFront returning one trade for item 1 and one for item 2 in every window.
+// Windows starting at or after failFrom get a 404, 0 never fails.
+func coldFront(t *testing.T, failFrom int64) *data.Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// transIDs only need to be unique per window here.
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		if failFrom > 0 && int64(start) >= failFrom {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<marketplace>
+<trans id="%d"><itemid>1</itemid><vol>1</vol><cost>10</cost><when>%d</when></trans>
+<trans id="%d"><itemid>2</itemid><vol>1</vol><cost>10</cost><when>%d</when></trans>
+</marketplace>`, start%1000000*10+1, start, start%1000000*10+2, start)
+	}))
+	t.Cleanup(srv.Close)
+	return &data.Client{HTTP: srv.Client(), Endpoints: data.Endpoints{ColdFront: srv.URL}}
+}
+
+func TestSyncAddsUnknownItems(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemStore()
+	if err := store.Ingest(ctx, database.Run{Items: []structs.Items{{ID: 1, Name: "known"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultSyncOptions
+	opts.Client = coldFront(t, 0)
+	opts.InitialLookback = 2 * time.Hour
+	opts.Overlap = 0
+	result, err := Sync(ctx, store, opts)
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+	if want := []int{2}; !reflect.DeepEqual(result.NewItems, want) {
+		t.Errorf("Sync() NewItems = %v, want %v", result.NewItems, want)
+	}
+	// Both items' trades in every window, none left behind the watermark.
+	if result.Rows != 2*len(result.Windows) {
+		t.Errorf("Sync() stored %d row(s) from %d window(s), want 2 per window", result.Rows, len(result.Windows))
+	}
+	if want := []structs.Items{{ID: 1, Name: "known"}, {ID: 2}}; !reflect.DeepEqual(store.Items(), want) {
+		t.Errorf("Items() = %v, want %v", store.Items(), want)
+	}
+	last, err := store.LastModified(ctx, "dbUpdate")
+	if err != nil {
+		t.Fatalf("LastModified() error = %v, want Sync's watermark", err)
+	}
+	if !last.Equal(result.End.Truncate(time.Second)) {
+		t.Errorf("LastModified() = %v, want %v", last, result.End)
+	}
+}
+
+func TestSyncStoresInSpans(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemStore()
+	store.AssumeItems([]int{1, 2})
+
+	// Spans start 2h, 1.5h, 1h and 30m back, the last one fails.
+	opts := DefaultSyncOptions
+	opts.Client = coldFront(t, time.Now().Add(-45*time.Minute).Unix())
+	opts.InitialLookback = 2 * time.Hour
+	opts.MaxSpan = 30 * time.Minute
+	opts.Overlap = 0
+	result, err := Sync(ctx, store, opts)
+	if err == nil {
+		t.Fatal("Sync() worked, want the last span's fetch error")
+	}
+	if result.Rows != 6 {
+		t.Errorf("Sync() stored %d row(s), want 2 for each of the 3 spans before the failure", result.Rows)
+	}
+	// The spans that went in stay, the next Sync resumes after them.
+	stored := result.Start.Add(90 * time.Minute).Truncate(time.Second)
+	if last, err := store.LastModified(ctx, "dbUpdate"); err != nil || !last.Equal(stored) {
+		t.Errorf("LastModified() = %v, %v, want the third span's end %v", last, err, stored)
+	}
+
+	opts.Client = coldFront(t, 0)
+	result, err = Sync(ctx, store, opts)
+	if err != nil {
+		t.Fatalf("Sync() retry error = %v", err)
+	}
+	if !result.Start.Equal(stored) || result.Rows != 2 {
+		t.Errorf("Sync() retry = %s with %d row(s), want from %s with 2", result.Start, result.Rows, stored)
+	}
+	if got := len(store.MarketTrans()); got != 8 {
+		t.Errorf("MarketTrans() has %d row(s), want 8", got)
+	}
+}
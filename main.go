@@ -1,253 +1,336 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"os"
-	"sync"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
+	// schedule.timezone works on hosts without a zoneinfo database.
+	_ "time/tzdata"
 
+	"github.com/abramtrinh/koldb/config"
 	"github.com/abramtrinh/koldb/data"
 	"github.com/abramtrinh/koldb/database"
-	"github.com/abramtrinh/koldb/structs"
 )
 
-var filePath string = "./"
-var itemsJSON string = filePath + "items.json"
-var miniLatestPrices string = filePath + "testLatestPrices.json"
-var miniMafiaPrices string = filePath + "testMafiaPrices.json"
-var miniNewMarketAll string = filePath + "testNewMarketAll.json"
-var miniNewMarketID string = filePath + "testNewMarketID.json"
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitUsage   = 2
+	exitMissing = 3
+)
 
-func main() {
-	//TempTestData()
+// usageError is a bad command line. main exits with exitUsage for these.
+type usageError struct {
+	msg string
+}
 
-	err := database.DBConnectInit()
-	if err != nil {
-		fmt.Printf("error DBConnectInit() %v\n", err)
-		return
-	}
+func (e *usageError) Error() string {
+	return e.msg
+}
 
-	//TempTestInsertItems()
-	//TempTestInsertMafiaPrices()
-	//TempTestInsertMarketTrans()
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
 
+// command is one koldb subcommand. args are what came after its name.
+type command struct {
+	name  string
+	usage string
+	about string
+	run   func(ctx context.Context, a *app, args []string) error
 }
 
-// Takes in any data slice and marshals into given fileName
-func MarshalToJSONFile(itemList any, fileName string) error {
-	// I should check that the itemList is a valid struct from pkg.
-	content, err := json.Marshal(itemList)
-	if err != nil {
-		return fmt.Errorf("error marshalling itemList: %w", err)
+var commands []command
+
+func init() {
+	commands = []command{
+		{"fetch", "fetch items|trans|prices|mafia [flags]", "download one upstream feed (or a source by name) to a JSON file", runFetch},
+		{"load", "load [flags] <file>", "store a JSON file written by fetch", runLoad},
+		{"sync", "sync [flags]", "store ColdFront transactions since the last sync", runSync},
+		{"backfill", "backfill -from <time> [-to <time>] [flags]", "store ColdFront transactions for a time range", runBackfill},
+		{"refresh-prices", "refresh-prices [interval]", "store ColdFront latest prices for every known item", runRefreshPrices},
+		{"daemon", "daemon [-jobs name,name]", "run the ingest jobs on their schedule.* config", runDaemon},
+		{"schedule", "schedule list [-n count]", "show when the daemon runs each job next", runSchedule},
+		{"migrate", "migrate up|down [n]|status", "run the schema migrations", runMigrate},
+		// run handles it before the config is loaded.
+		{"help", "help", "show this", nil},
 	}
-	err = os.WriteFile(fileName, content, 0660)
-	if err != nil {
-		return fmt.Errorf("error writing to %v: %v", fileName, err)
-	}
-	fmt.Printf("Wrote item data to %s\n", fileName)
-	return nil
 }
 
-// Opens JSON file and returns it in byte slice for unmarshalling.
-func OpenReadJSONFile(fileName string) ([]byte, error) {
-	// I should check that it is a JSON file.
-	jsonFile, err := os.Open(fileName)
-	if err != nil {
-		return nil, fmt.Errorf("error opening file: %w", err)
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
 	}
-	fmt.Printf("Opened %s.\n", fileName)
-	defer jsonFile.Close()
+	return command{}, false
+}
 
-	byteSlice, err := io.ReadAll(jsonFile)
+// app is what every command gets: the loaded config and a store opened on first use.
+type app struct {
+	cfg    config.Config
+	dryRun bool
+	store  database.Store
+}
+
+// Store opens the configured database (or a MemStore with --dry-run) the first time it's called.
+func (a *app) Store(ctx context.Context) (database.Store, error) {
+	if a.store != nil {
+		return a.store, nil
+	}
+	if a.dryRun {
+		a.store = database.NewMemStore()
+		return a.store, nil
+	}
+	store, err := database.Open(ctx, a.cfg.Store())
 	if err != nil {
-		return nil, fmt.Errorf("error reading file: %w", err)
+		return nil, fmt.Errorf("error database.Open() %w", err)
 	}
-
-	return byteSlice, nil
+	a.store = store
+	return a.store, nil
 }
 
-// Here to test data package functionality. Should return 4 JSON files with data.
-// Note: Files are written to ./koldb
-func TempTestData() {
-	// Time == Now
-	endTime := time.Now().Unix()
-	// Time == Exactly 1 Day ago
-	startTime := endTime - data.EpochDay
-
-	mUI := data.MarketURLItems()
-
-	// Transactions of 24 hours ago till now of just Mr. A
-	mUTID := data.MarketURLTransID(startTime, endTime, "194")
-	// All transactions from 24 hours ago till now.
-	mUTA := data.MarketURLTransAll(startTime, endTime)
-	intSlice := []int{
-		194,
-		895,
-		896,
+// UpstreamStore is Store for the commands that fetch from upstream. The empty
+// --dry-run store would turn away every price and transaction, so it acts like
+// the upstream item list is already stored, same as a database that's been synced.
+func (a *app) UpstreamStore(ctx context.Context) (database.Store, error) {
+	store, err := a.Store(ctx)
+	if err != nil || !a.dryRun {
+		return store, err
 	}
-	// Latest Prices of 194, 895, 896
-	marUP, _ := data.MarketURLPrices(intSlice)
-	// Prices of each item's 5th listing.
-	mafUP := data.MafiaURLPrices()
-
-	fmt.Println("Starting")
-
-	itemList0, err := data.MarketParseItems(mUI)
+	ids, err := upstreamItemIDs(ctx)
 	if err != nil {
-		fmt.Printf("error 0 MarketParseItems: %v\n", err)
+		fmt.Fprintf(os.Stderr, "dry run: every item counts as unknown, %v\n", err)
 	}
+	a.assumeItems(ids)
+	return store, nil
+}
 
-	if err := MarshalToJSONFile(itemList0, "items.json"); err != nil {
-		fmt.Printf("error 0 MarshalToJSONFile: %v\n", err)
+// With --dry-run, ids count as stored items (see MemStore.AssumeItems).
+// Does nothing against a real database.
+func (a *app) assumeItems(ids []int) {
+	if mem, ok := a.store.(*database.MemStore); ok {
+		mem.AssumeItems(ids)
 	}
+}
 
-	fmt.Println("Done Zero")
-	time.Sleep(time.Second * 5)
-	fmt.Println("Start First")
-
-	itemList1, err := data.MarketParseTrans(mUTID)
+// The upstream item list's IDs.
+func upstreamItemIDs(ctx context.Context) ([]int, error) {
+	src, ok := data.LookupKind(data.KindItems)
+	if !ok {
+		return nil, fmt.Errorf("error no single item list source")
+	}
+	batch, err := src.Fetch(ctx, data.Window{})
 	if err != nil {
-		fmt.Printf("error 1 MarketParseTrans: %v\n", err)
+		return nil, fmt.Errorf("error fetching the item list: %w", err)
+	}
+	ids := make([]int, len(batch.Items))
+	for i, item := range batch.Items {
+		ids[i] = item.ID
 	}
+	return ids, nil
+}
 
-	if err := MarshalToJSONFile(itemList1, "testNewMarketID.json"); err != nil {
-		fmt.Printf("error 1 MarshalToJSONFile: %v\n", err)
+func (a *app) Close() {
+	if a.store != nil {
+		a.store.Close()
 	}
+}
 
-	fmt.Println("Done First")
-	time.Sleep(time.Second * 5)
-	fmt.Println("Start Second")
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-	itemList2, err := data.MarketParseTrans(mUTA)
-	if err != nil {
-		fmt.Printf("error 2 MarketParseTrans: %v\n", err)
+// Parses the global flags, loads the config and runs the command. Returns the exit code.
+func run(args []string) int {
+	fs := flag.NewFlagSet("koldb", flag.ContinueOnError)
+	fs.Usage = func() { printUsage(fs) }
+	// --dry-run keeps everything in memory so nothing touches the database.
+	dryRun := fs.Bool("dry-run", false, "use an in-memory store instead of the configured database")
+	configFlags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
 	}
-
-	if err := MarshalToJSONFile(itemList2, "testNewMarketAll.json"); err != nil {
-		fmt.Printf("error 2 MarshalToJSONFile: %v\n", err)
+	args = fs.Args()
+	if len(args) == 0 {
+		printUsage(fs)
+		return exitUsage
+	}
+	cmd, ok := lookupCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q. See koldb help\n", args[0])
+		return exitUsage
+	}
+	if cmd.name == "help" {
+		printUsage(fs)
+		return exitOK
 	}
 
-	fmt.Println("Done Second")
-	time.Sleep(time.Second * 5)
-	fmt.Println("Start Third")
-
-	itemList3, err := data.MarketParsePrices(marUP)
+	cfg, err := config.Load(configFlags)
 	if err != nil {
-		fmt.Printf("error 3 MarketParsePrices: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
 	}
+	data.DefaultClient = cfg.Client()
 
-	if err := MarshalToJSONFile(itemList3, "testLatestPrices.json"); err != nil {
-		fmt.Printf("error 3 MarshalToJSONFile: %v\n", err)
-	}
+	// Ctrl-C or SIGTERM cancels whatever is in flight instead of killing it mid-write.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	fmt.Println("Done Third")
-	time.Sleep(time.Second * 5)
-	fmt.Println("Start Last")
+	a := &app{cfg: cfg, dryRun: *dryRun}
+	defer a.Close()
 
-	itemList4, err := data.MafiaParsePrices(mafUP)
-	if err != nil {
-		fmt.Printf("error 4 MafiaParsePrices: %v\n", err)
+	err = cmd.run(ctx, a, args[1:])
+	if mem, ok := a.store.(*database.MemStore); ok {
+		fmt.Printf("dry run: would have stored %d item(s), %d mafia price(s), %d market price(s), %d transaction(s)\n",
+			len(mem.Items()), len(mem.MafiaPrices()), len(mem.MarketPrices()), len(mem.MarketTrans()))
 	}
+	return exitCode(cmd, err)
+}
 
-	if err := MarshalToJSONFile(itemList4, "testMafiaPrices.json"); err != nil {
-		fmt.Printf("error 4 MarshalToJSONFile: %v\n", err)
+func exitCode(cmd command, err error) int {
+	var usageErr *usageError
+	var missingErr *missingError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "%v\nusage: koldb %s\n", err, cmd.usage)
+		return exitUsage
+	case errors.As(err, &missingErr):
+		fmt.Fprintln(os.Stderr, err)
+		return exitMissing
+	default:
+		fmt.Fprintf(os.Stderr, "error %s: %v\n", cmd.name, err)
+		return exitFailed
 	}
-
-	fmt.Println("Done Last")
 }
 
-// Note: Could run these batch file updates as a database transaction. Not sure if needed.
-func TempTestInsertItems() {
-	byteSlice, err := OpenReadJSONFile(itemsJSON)
-	if err != nil {
-		fmt.Printf("error openReadFile %v\n", err)
-		return
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintf(out, "usage: koldb [global flags] <command> [flags] [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-44s %s\n", cmd.usage, cmd.about)
 	}
+	fmt.Fprintf(out, "\nexit codes: %d ok, %d failed, %d bad usage or config, %d done but some upstream data missing\n",
+		exitOK, exitFailed, exitUsage, exitMissing)
+	fmt.Fprintf(out, "\nglobal flags:\n")
+	fs.PrintDefaults()
+}
 
-	var items []structs.Items
-	err = json.Unmarshal(byteSlice, &items)
-	if err != nil {
-		fmt.Printf("error unmarshalling %v\n", err)
-		return
-	}
+// Flag set for one command. Errors come back from Parse instead of exiting.
+func newFlagSet(cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
 
-	start := time.Now()
+// Parses args into fs. Bad flags are a usageError. flag already printed why.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usagef("bad flags for %s", fs.Name())
+	}
+	return nil
+}
 
-	//Waitgroup is used so all goroutines and finish running.
-	var wg sync.WaitGroup
-	for i := 0; i < len(items); i++ {
-		wg.Add(1)
-		//Go routines used so I can concurrently insert things.
-		//Speed diff of 27s->3s when using MaxOpenConns=25
-		go database.InsertItems(&wg, items[i].ID, items[i].Name)
-		/*
-			BIG NOTE: error returns for insertItems and the like are not handled.
-			Check out "handling goroutine errors" / "goroutines with error returns"
-			Goroutine errors are not checked. Could not use goroutines and check errors normally.
-			Use channels, error groups, or logging possibly?
-		*/
+// Accepts RFC3339, "2006-01-02 15:04:05", "2006-01-02" (all UTC unless an offset
+// is given) or epoch seconds. "" is the zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC(), nil
 	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad time %q, want 2006-01-02, RFC3339 or epoch seconds", value)
+}
 
-	wg.Wait()
-	end := time.Now()
-	fmt.Printf("took %v\n", end.Sub(start))
-	fmt.Println("Done init items table.")
+// timeFlag is a flag.Value for parseTime.
+type timeFlag struct {
+	t *time.Time
 }
 
-func TempTestInsertMafiaPrices() {
-	byteSlice, err := OpenReadJSONFile(miniMafiaPrices)
-	if err != nil {
-		fmt.Printf("error openReadFile %v\n", err)
-		return
+func (f timeFlag) String() string {
+	if f.t == nil || f.t.IsZero() {
+		return ""
 	}
+	return f.t.Format(time.RFC3339)
+}
 
-	var mafiaPrices []structs.MafiaPrices
-	err = json.Unmarshal(byteSlice, &mafiaPrices)
+func (f timeFlag) Set(value string) error {
+	t, err := parseTime(value)
 	if err != nil {
-		fmt.Printf("error unmarshalling %v\n", err)
-		return
+		return err
 	}
+	*f.t = t
+	return nil
+}
 
-	start := time.Now()
-
-	var wg sync.WaitGroup
-	for i := 0; i < len(mafiaPrices); i++ {
-		wg.Add(1)
-		go database.InsertMafiaPrices(&wg, mafiaPrices[i].ItemID, mafiaPrices[i].Price, mafiaPrices[i].Time)
+// "194,895" to []int{194, 895}.
+func parseIDs(value string) ([]int, error) {
+	var ids []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil || id < 1 {
+			return nil, fmt.Errorf("bad item ID %q", field)
+		}
+		ids = append(ids, id)
 	}
-
-	wg.Wait()
-	end := time.Now()
-	fmt.Printf("took %v\n", end.Sub(start))
-	fmt.Println("Done init mafia prices table.")
+	return ids, nil
 }
 
-func TempTestInsertMarketTrans() {
-	byteSlice, err := OpenReadJSONFile(miniNewMarketAll)
+// Takes in any data slice and marshals into fileName.
+func MarshalToJSONFile(itemList any, fileName string) error {
+	content, err := json.Marshal(itemList)
 	if err != nil {
-		fmt.Printf("error openReadFile %v\n", err)
-		return
+		return fmt.Errorf("error marshalling itemList: %w", err)
 	}
-
-	var mafiaTrans []structs.MarketTrans
-	err = json.Unmarshal(byteSlice, &mafiaTrans)
+	err = os.WriteFile(fileName, content, 0660)
 	if err != nil {
-		fmt.Printf("error unmarshalling %v\n", err)
-		return
+		return fmt.Errorf("error writing to %v: %w", fileName, err)
 	}
+	return nil
+}
 
-	start := time.Now()
+// Opens JSON file and returns it in byte slice for unmarshalling.
+func OpenReadJSONFile(fileName string) ([]byte, error) {
+	jsonFile, err := os.Open(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer jsonFile.Close()
 
-	var wg sync.WaitGroup
-	for i := 0; i < len(mafiaTrans); i++ {
-		wg.Add(1)
-		go database.InsertMarketTrans(&wg, mafiaTrans[i].TransID, mafiaTrans[i].ItemID, mafiaTrans[i].Volume, mafiaTrans[i].Price, mafiaTrans[i].Time)
+	byteSlice, err := io.ReadAll(jsonFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
-	wg.Wait()
-	end := time.Now()
-	fmt.Printf("took %v\n", end.Sub(start))
-	fmt.Println("Done init market trans table.")
+	return byteSlice, nil
 }
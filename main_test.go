@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abramtrinh/koldb/data"
+	"github.com/abramtrinh/koldb/database"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "", want: time.Time{}},
+		{value: "1700000000", want: time.Unix(1700000000, 0).UTC()},
+		{value: "2024-01-02", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-02 03:04:05", want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{value: "2024-01-02T03:04:05-07:00", want: time.Date(2024, 1, 2, 10, 4, 5, 0, time.UTC)},
+		{value: "yesterday", wantErr: true},
+		{value: "2024-13-01", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseIDs(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: "194", want: []int{194}},
+		{value: "194, 895,,", want: []int{194, 895}},
+		{value: "194,x", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "-3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseIDs(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIDs(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIDs(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDryRunLoadStaysOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("load --dry-run fetched %s", r.URL)
+	}))
+	defer srv.Close()
+	defaultClient := data.DefaultClient
+	data.DefaultClient = &data.Client{HTTP: srv.Client(), Endpoints: data.Endpoints{ColdFront: srv.URL, Mafia: srv.URL}}
+	defer func() { data.DefaultClient = defaultClient }()
+
+	file := filepath.Join(t.TempDir(), "trans.json")
+	body := `[{"trans": 1, "itemid": 194, "vol": 1, "price": 10, "time": 1700000000}]`
+	if err := os.WriteFile(file, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &app{dryRun: true}
+	if err := runLoad(context.Background(), a, []string{file}); err != nil {
+		t.Fatalf("runLoad() error = %v", err)
+	}
+	// The file's item counts as stored, so its trade goes in.
+	if trans := a.store.(*database.MemStore).MarketTrans(); len(trans) != 1 {
+		t.Errorf("MarketTrans() = %v, want the file's trade", trans)
+	}
+}
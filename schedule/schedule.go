@@ -0,0 +1,242 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule says when a job fires.
+type Schedule interface {
+	// Next is the first fire time after t.
+	Next(t time.Time) time.Time
+}
+
+// Every fires once per duration.
+type Every time.Duration
+
+func (e Every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return "every " + time.Duration(e).String()
+}
+
+// Cron fires on a standard 5 field cron expression (minute hour day month weekday)
+// or a descriptor like @daily. Fire times are worked out in the time zone of the
+// time Next is given, see In, unless the spec starts with CRON_TZ=<zone>.
+type Cron struct {
+	spec     string
+	schedule cron.Schedule
+}
+
+func (c Cron) Next(t time.Time) time.Time {
+	return c.schedule.Next(t)
+}
+
+func (c Cron) String() string {
+	return c.spec
+}
+
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Parse reads a Schedule from config: a duration like 10m or 24h, or a cron
+// expression like "35 3 * * *". "", "0" and "off" are a nil Schedule, the job doesn't run.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "", "0", "off":
+		return nil, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every"))); err == nil {
+		if d <= 0 {
+			return nil, fmt.Errorf("must be > 0, got %v", d)
+		}
+		return Every(d), nil
+	}
+	s, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("want a duration like 10m or a cron expression like \"35 3 * * *\", got %q: %v", spec, err)
+	}
+	return Cron{spec: spec, schedule: s}, nil
+}
+
+// In works out s's fire times in loc, so "0 4 * * *" is 4am there and not UTC.
+// Every fires the same in any zone.
+func In(s Schedule, loc *time.Location) Schedule {
+	if _, ok := s.(Every); ok || s == nil || loc == nil {
+		return s
+	}
+	// Its own zone wins.
+	if c, ok := s.(Cron); ok && (strings.HasPrefix(c.spec, "CRON_TZ=") || strings.HasPrefix(c.spec, "TZ=")) {
+		return s
+	}
+	return located{Schedule: s, loc: loc}
+}
+
+type located struct {
+	Schedule
+	loc *time.Location
+}
+
+func (l located) Next(t time.Time) time.Time {
+	return l.Schedule.Next(t.In(l.loc))
+}
+
+func (l located) String() string {
+	return fmt.Sprintf("%v (%s)", l.Schedule, l.loc)
+}
+
+// First is when a job on s runs first after starting at now.
+// Every runs at its next fire time after last, or now if that already went by or
+// it never ran (zero last). Cron is pinned to the clock (ex. only overnight) so it
+// never catches up, it waits for its next fire time after now.
+func First(s Schedule, last time.Time, now time.Time) time.Time {
+	if !catchesUp(s) {
+		return s.Next(now)
+	}
+	if last.IsZero() {
+		return now
+	}
+	if next := s.Next(last); next.After(now) {
+		return next
+	}
+	return now
+}
+
+func catchesUp(s Schedule) bool {
+	if l, ok := s.(located); ok {
+		s = l.Schedule
+	}
+	_, ok := s.(Every)
+	return ok
+}
+
+// Job is something the Scheduler runs.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs each Job on its own Schedule. A job never overlaps itself:
+// fire times that go by while it's still running are skipped, not queued.
+// Different jobs do run at the same time.
+type Scheduler struct {
+	Jobs []Job
+	// When job last ran, so a restart carries on an Every schedule instead of
+	// running everything straight away. See First.
+	LastRun func(ctx context.Context, job string) (time.Time, error)
+	// nil is quiet.
+	Logf func(format string, args ...any)
+}
+
+// Run schedules the jobs until stop is closed, then waits for any that are
+// running to finish. Jobs get ctx, cancel it to abort them too.
+// Returns ctx.Err() if ctx ended it, nil if stop did.
+func (s *Scheduler) Run(ctx context.Context, stop <-chan struct{}) error {
+	if len(s.Jobs) == 0 {
+		return fmt.Errorf("error scheduler has no jobs")
+	}
+	names := map[string]bool{}
+	for _, job := range s.Jobs {
+		if job.Schedule == nil || job.Run == nil {
+			return fmt.Errorf("error scheduler job %q needs a Schedule and Run", job.Name)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("error scheduler job %q is listed twice", job.Name)
+		}
+		names[job.Name] = true
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range s.Jobs {
+		job := job
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, stop, job)
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Scheduler) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// First fire time for job.
+func (s *Scheduler) first(ctx context.Context, job Job, now time.Time) time.Time {
+	if s.LastRun == nil {
+		return now
+	}
+	last, err := s.LastRun(ctx, job.Name)
+	if err != nil {
+		s.logf("%s: error reading last run, running now: %v", job.Name, err)
+		return now
+	}
+	return First(job.Schedule, last, now)
+}
+
+// Runs job once. A panic is the run's error so it doesn't take down the other jobs.
+func (s *Scheduler) run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// Runs job at each fire time until stop or ctx is done.
+func (s *Scheduler) loop(ctx context.Context, stop <-chan struct{}, job Job) {
+	next := s.first(ctx, job, time.Now())
+	s.logf("%s: next run %s", job.Name, next.Format(time.RFC3339))
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-stop:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		// stop and the timer can be ready together. Don't start anything new once stopping.
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		s.logf("%s: starting", job.Name)
+		started := time.Now()
+		if err := s.run(ctx, job); err != nil {
+			s.logf("%s: failed after %v: %v", job.Name, time.Since(started).Round(time.Millisecond), err)
+		} else {
+			s.logf("%s: done in %v", job.Name, time.Since(started).Round(time.Millisecond))
+		}
+
+		finished := time.Now()
+		skipped := 0
+		next = job.Schedule.Next(next)
+		for !next.After(finished) {
+			skipped++
+			next = job.Schedule.Next(next)
+		}
+		if skipped > 0 {
+			s.logf("%s: skipped %d run(s) that would have overlapped", job.Name, skipped)
+		}
+		s.logf("%s: next run %s", job.Name, next.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,175 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "", want: "<nil>"},
+		{spec: "0", want: "<nil>"},
+		{spec: "off", want: "<nil>"},
+		{spec: "10m", want: "every 10m0s"},
+		{spec: "@every 2h", want: "every 2h0m0s"},
+		{spec: "35 3 * * *", want: "35 3 * * *"},
+		{spec: "@daily", want: "@daily"},
+		{spec: "-5m", wantErr: true},
+		{spec: "35 3 * *", wantErr: true},
+		{spec: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if s := toString(got); s != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.spec, s, tt.want)
+		}
+	}
+}
+
+func toString(s Schedule) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return s.(interface{ String() string }).String()
+}
+
+func mustParse(t *testing.T, spec string) Schedule {
+	t.Helper()
+	s, err := Parse(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestIn(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	// 4am in Berlin is 3am UTC in winter.
+	got := In(mustParse(t, "0 4 * * *"), berlin).Next(now)
+	if want := time.Date(2026, 1, 11, 3, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+	// The spec's own zone wins.
+	got = In(mustParse(t, "CRON_TZ=UTC 0 4 * * *"), berlin).Next(now)
+	if want := time.Date(2026, 1, 11, 4, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("CRON_TZ Next() = %v, want %v", got, want)
+	}
+	if s := In(Every(time.Hour), berlin); s != Every(time.Hour) {
+		t.Errorf("In(Every) = %v, want it as is", s)
+	}
+}
+
+func TestFirst(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	hourly := Every(time.Hour)
+	daily := mustParse(t, "30 3 * * *")
+
+	tests := []struct {
+		name string
+		s    Schedule
+		last time.Time
+		want time.Time
+	}{
+		{"every never ran", hourly, time.Time{}, now},
+		{"every ran recently", hourly, now.Add(-10 * time.Minute), now.Add(50 * time.Minute)},
+		{"every overdue", hourly, now.Add(-3 * time.Hour), now},
+		{"cron never ran", daily, time.Time{}, time.Date(2026, 1, 11, 3, 30, 0, 0, time.UTC)},
+		{"cron overdue waits", daily, now.Add(-72 * time.Hour), time.Date(2026, 1, 11, 3, 30, 0, 0, time.UTC)},
+		{"located every still catches up", In(hourly, time.UTC), now.Add(-3 * time.Hour), now},
+	}
+	for _, tt := range tests {
+		if got := First(tt.s, tt.last, now); !got.Equal(tt.want) {
+			t.Errorf("%s: First() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerValidates(t *testing.T) {
+	run := func(context.Context) error { return nil }
+	tests := []struct {
+		name string
+		jobs []Job
+	}{
+		{"no jobs", nil},
+		{"no schedule", []Job{{Name: "a", Run: run}}},
+		{"no run", []Job{{Name: "a", Schedule: Every(time.Second)}}},
+		{"twice", []Job{{Name: "a", Schedule: Every(time.Second), Run: run}, {Name: "a", Schedule: Every(time.Second), Run: run}}},
+	}
+	for _, tt := range tests {
+		s := &Scheduler{Jobs: tt.jobs}
+		if err := s.Run(context.Background(), make(chan struct{})); err == nil {
+			t.Errorf("%s: Run() worked, want an error", tt.name)
+		}
+	}
+}
+
+func TestSchedulerSurvivesPanics(t *testing.T) {
+	var panics, runs atomic.Int32
+	stop := make(chan struct{})
+	s := &Scheduler{
+		Jobs: []Job{
+			{Name: "bad", Schedule: Every(20 * time.Millisecond), Run: func(context.Context) error {
+				panics.Add(1)
+				var ids []int
+				_ = ids[1]
+				return nil
+			}},
+			{Name: "good", Schedule: Every(20 * time.Millisecond), Run: func(context.Context) error {
+				runs.Add(1)
+				return errors.New("failed normally")
+			}},
+		},
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(stop)
+	}()
+	if err := s.Run(context.Background(), stop); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if panics.Load() < 2 || runs.Load() < 2 {
+		t.Errorf("bad ran %d time(s), good %d, want both to keep running", panics.Load(), runs.Load())
+	}
+}
+
+func TestSchedulerSkipsOverlaps(t *testing.T) {
+	var runs atomic.Int32
+	stop := make(chan struct{})
+	s := &Scheduler{
+		Jobs: []Job{{Name: "slow", Schedule: Every(10 * time.Millisecond), Run: func(context.Context) error {
+			runs.Add(1)
+			time.Sleep(55 * time.Millisecond)
+			return nil
+		}}},
+	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(stop)
+	}()
+	if err := s.Run(context.Background(), stop); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// Without skipping, the runs missed while sleeping would pile up.
+	if n := runs.Load(); n > 2 {
+		t.Errorf("slow ran %d times in 100ms, want at most 2", n)
+	}
+}